@@ -0,0 +1,361 @@
+package broadcast
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/elemecca/go-hotplug"
+	"net"
+	"runtime/debug"
+	"sync"
+)
+
+// ErrDisconnected is the cause of the cancellation of an Interface's Context
+// when the connection to the server was lost.
+var ErrDisconnected = errors.New("disconnected from broadcast server")
+
+// ClientCallback is called with each interface reported by a Client.
+type ClientCallback func(iface *Interface)
+
+// An Interface is a device interface reported by a Server. It provides the
+// same means of following the interface's removal as a DeviceInterface.
+type Interface struct {
+	hotplug.InterfaceInfo
+
+	client *Client
+
+	// inArrive is set while the arrive callback runs, and is protected by
+	// the Client's lock since OnDetach may be called from any goroutine
+	inArrive bool
+
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+	detachCb []func()
+}
+
+// OnDetach registers a callback to be called when the interface is removed.
+// It must be called while the arrive callback is running, usually from the
+// callback itself, though it may be called from any goroutine.
+func (iface *Interface) OnDetach(callback func()) error {
+	iface.client.lock.Lock()
+	defer iface.client.lock.Unlock()
+
+	if !iface.inArrive {
+		return errors.New("OnDetach must be called from the arrive callback")
+	}
+
+	iface.detachCb = append(iface.detachCb, callback)
+	return nil
+}
+
+// Done returns a channel which is closed when the interface is removed, the
+// connection to the server is lost or the Client is stopped. It may be used
+// from any goroutine.
+func (iface *Interface) Done() <-chan struct{} {
+	return iface.ctx.Done()
+}
+
+// Context returns a context which is cancelled when the interface is
+// removed, the connection to the server is lost or the Client is stopped.
+// Its cause is hotplug.ErrRemoved, ErrDisconnected or hotplug.ErrStopped
+// respectively.
+func (iface *Interface) Context() context.Context {
+	return iface.ctx
+}
+
+// A ClientOption configures optional behaviour of a Client.
+type ClientOption func(c *Client) error
+
+// ClientOnError sets a function to be called with each panic in a callback,
+// as a *hotplug.PanicError. The Client recovers from such panics and carries
+// on delivering events.
+func ClientOnError(handler func(err error)) ClientOption {
+	return func(c *Client) error {
+		c.errHandler = handler
+		return nil
+	}
+}
+
+// A Client reports the arrival and removal of the device interfaces
+// broadcast by a Server, like a hotplug.Listener. The callbacks are called
+// one at a time from a goroutine owned by the Client.
+//
+// A Client is safe for concurrent use by multiple goroutines.
+type Client struct {
+	socketPath string
+	sub        Subscription
+	callback   ClientCallback
+	errHandler func(err error)
+
+	// runLock serializes connecting and disconnecting
+	runLock sync.Mutex
+	conn    net.Conn
+	done    chan struct{}
+
+	// lock protects the fields below
+	lock     sync.Mutex
+	stopping bool
+	err      error
+	present  map[string]*Interface
+}
+
+// NewClient creates a Client which will connect to the Server listening on
+// the Unix domain socket at the given path and report the interfaces
+// selected by the subscription.
+func NewClient(
+	socketPath string,
+	sub Subscription,
+	callback ClientCallback,
+	options ...ClientOption,
+) (*Client, error) {
+	err := sub.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		socketPath: socketPath,
+		sub:        sub,
+		callback:   callback,
+		present:    make(map[string]*Interface),
+	}
+
+	for _, option := range options {
+		err = option(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Listen connects to the server and calls the callback each time an
+// interface arrives.
+func (c *Client) Listen() error {
+	return c.connect(false)
+}
+
+// Start connects to the server and calls the callback for each interface
+// which is already present and then each time an interface arrives, like
+// hotplug.Listener.Start. It returns once the present interfaces have been
+// reported.
+func (c *Client) Start() error {
+	return c.connect(true)
+}
+
+func (c *Client) connect(existing bool) error {
+	c.runLock.Lock()
+	defer c.runLock.Unlock()
+
+	if c.conn != nil {
+		select {
+		case <-c.done:
+			// the connection was lost, so we can reconnect
+			c.conn.Close()
+			c.conn = nil
+		default:
+			return errors.New("client is already connected")
+		}
+	}
+
+	conn, err := net.Dial("unix", c.socketPath)
+	if err != nil {
+		return err
+	}
+
+	err = json.NewEncoder(conn).Encode(&c.sub)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	c.lock.Lock()
+	c.stopping = false
+	c.err = nil
+	c.lock.Unlock()
+
+	// read the snapshot here so that it has been reported when we return
+	decoder := json.NewDecoder(bufio.NewReader(conn))
+	for {
+		var msg Message
+		err = decoder.Decode(&msg)
+		if err != nil {
+			conn.Close()
+			c.disconnect(ErrDisconnected)
+			return err
+		}
+
+		if msg.Type == MessageSynced {
+			break
+		}
+
+		err = c.handle(&msg, existing)
+		if err != nil {
+			conn.Close()
+			c.disconnect(ErrDisconnected)
+			return err
+		}
+	}
+
+	c.conn = conn
+	c.done = make(chan struct{})
+	go c.receive(decoder, c.done)
+
+	return nil
+}
+
+// receive handles messages from the server until the connection is closed.
+func (c *Client) receive(decoder *json.Decoder, done chan struct{}) {
+	defer close(done)
+
+	for {
+		var msg Message
+		err := decoder.Decode(&msg)
+		if err == nil {
+			err = c.handle(&msg, true)
+		}
+		if err == nil {
+			continue
+		}
+
+		c.lock.Lock()
+		stopping := c.stopping
+		if !stopping {
+			c.err = err
+		}
+		c.lock.Unlock()
+
+		if !stopping {
+			c.disconnect(ErrDisconnected)
+		}
+		return
+	}
+}
+
+// handle acts on a message from the server, reporting arrivals only if
+// report is true.
+func (c *Client) handle(msg *Message, report bool) error {
+	switch msg.Type {
+	case MessageError:
+		return errors.New("broadcast server: " + msg.Error)
+
+	case MessageEvent:
+		if msg.Event == nil {
+			return errors.New("broadcast server sent an event message without an event")
+		}
+		info := msg.Event.Interface
+
+		switch msg.Event.Action {
+		case hotplug.ActionArrive:
+			if report {
+				c.arrive(info)
+			}
+
+		case hotplug.ActionRemove:
+			c.lock.Lock()
+			iface := c.present[info.Path]
+			delete(c.present, info.Path)
+			c.lock.Unlock()
+
+			if iface != nil {
+				c.detach(iface, hotplug.ErrRemoved)
+			}
+		}
+	}
+
+	// ignore messages we don't understand for the sake of future versions
+	return nil
+}
+
+func (c *Client) arrive(info hotplug.InterfaceInfo) {
+	iface := &Interface{InterfaceInfo: info, client: c}
+	iface.ctx, iface.cancel = context.WithCancelCause(context.Background())
+
+	c.lock.Lock()
+	c.present[info.Path] = iface
+	iface.inArrive = true
+	c.lock.Unlock()
+
+	c.protect(func() { c.callback(iface) })
+
+	c.lock.Lock()
+	iface.inArrive = false
+	c.lock.Unlock()
+}
+
+// protect runs a callback, recovering from and reporting any panic so that
+// it doesn't end the connection.
+func (c *Client) protect(fn func()) {
+	defer func() {
+		if value := recover(); value != nil && c.errHandler != nil {
+			c.errHandler(&hotplug.PanicError{Value: value, Stack: debug.Stack()})
+		}
+	}()
+
+	fn()
+}
+
+// detach runs an interface's detach callbacks and cancels its context.
+func (c *Client) detach(iface *Interface, cause error) {
+	c.lock.Lock()
+	callbacks := iface.detachCb
+	iface.detachCb = nil
+	c.lock.Unlock()
+
+	if cause == hotplug.ErrRemoved {
+		for _, callback := range callbacks {
+			if callback != nil {
+				c.protect(callback)
+			}
+		}
+	}
+
+	iface.cancel(cause)
+}
+
+// disconnect forgets the interfaces which were present, cancelling their
+// contexts with the given cause.
+func (c *Client) disconnect(cause error) {
+	c.lock.Lock()
+	present := c.present
+	c.present = make(map[string]*Interface)
+	c.lock.Unlock()
+
+	for _, iface := range present {
+		c.detach(iface, cause)
+	}
+}
+
+// Stop disconnects from the server. It waits for any callback which is
+// running to finish, so it must not be called from a callback.
+func (c *Client) Stop() error {
+	c.runLock.Lock()
+	defer c.runLock.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+
+	c.lock.Lock()
+	c.stopping = true
+	c.lock.Unlock()
+
+	err := c.conn.Close()
+	<-c.done
+	c.conn = nil
+	c.done = nil
+
+	c.disconnect(hotplug.ErrStopped)
+	return err
+}
+
+// Err returns the error which ended the connection to the server, or nil if
+// there has been none.
+func (c *Client) Err() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.err
+}
@@ -0,0 +1,191 @@
+package broadcast
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/elemecca/go-hotplug"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// keepAliveInterval is how often a comment is sent on an idle event stream
+// so that proxies don't time it out.
+const keepAliveInterval = 30 * time.Second
+
+// A Handler serves the interfaces reported by a Listener over HTTP.
+//
+// A GET request is answered with a JSON array of the hotplug.InterfaceInfo
+// of each interface which is present. A request which accepts
+// "text/event-stream", as a browser's EventSource does, is instead answered
+// with a stream of Server-Sent Events: an "arrive" event for each interface
+// which is present, a "synced" event, and then an "arrive" or "remove"
+// event as each interface arrives or is removed. The data of each arrive
+// and remove event is a hotplug.Event in JSON. If the stream is reconnected
+// it starts again from the interfaces which are present.
+//
+// The query string filters the interfaces, with the same meaning as the
+// fields of a Subscription:
+//
+//	class   interface class names, repeated or separated by commas
+//	vid     USB vendor ID in hexadecimal
+//	pid     USB product ID in hexadecimal
+//	serial  USB serial number
+//	port    USB port path
+//
+// Pass the Handler's Add method to New as the callback, or call it from the
+// callback, to feed it:
+//
+//	handler := broadcast.NewHandler()
+//	listener, err := hotplug.New(hotplug.DevIfHid, handler.Add)
+//	...
+//	err = listener.Start()
+//	mux.Handle("/devices", handler)
+type Handler struct {
+	hub *hub
+}
+
+func NewHandler() *Handler {
+	return &Handler{hub: newHub()}
+}
+
+// Handler returns a Handler which serves the interfaces reported by the
+// Server's Listeners.
+func (s *Server) Handler() *Handler {
+	return &Handler{hub: s.hub}
+}
+
+// Add adds an interface to those served by the Handler. It has the
+// signature of a ListenerCallback so that it can be passed to New.
+func (h *Handler) Add(devIf *hotplug.DeviceInterface) {
+	h.hub.add(devIf)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sub, err := parseSubscription(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		h.stream(w, r, sub)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.hub.interfaces(&sub))
+}
+
+// stream sends events until the client disconnects.
+func (h *Handler) stream(w http.ResponseWriter, r *http.Request, sub Subscription) {
+	rc := http.NewResponseController(w)
+
+	snapshot, s, err := h.hub.subscribe(sub, func() {
+		// unblock the writer if the client has stopped reading
+		rc.SetWriteDeadline(time.Now().Add(time.Second))
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer h.hub.unsubscribe(s)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	for _, evt := range snapshot {
+		if writeEvent(w, evt.Action, evt) != nil {
+			return
+		}
+	}
+
+	if writeEvent(w, "synced", struct{}{}) != nil || rc.Flush() != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case evt := <-s.queue:
+			err = writeEvent(w, evt.Action, evt)
+
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+
+		case <-s.closing:
+			if s.err != nil {
+				writeEvent(w, "error", map[string]string{"error": s.err.Error()})
+				rc.Flush()
+			}
+			return
+
+		case <-r.Context().Done():
+			return
+		}
+
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent writes a Server-Sent Event with JSON data.
+func writeEvent(w http.ResponseWriter, name string, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, encoded)
+	return err
+}
+
+// parseSubscription builds a Subscription from the query string of a
+// request.
+func parseSubscription(query url.Values) (Subscription, error) {
+	var sub Subscription
+
+	for _, value := range query["class"] {
+		for _, class := range strings.Split(value, ",") {
+			if class != "" {
+				sub.Classes = append(sub.Classes, class)
+			}
+		}
+	}
+
+	for _, param := range []struct {
+		name  string
+		value *int
+	}{
+		{"vid", &sub.VendorId},
+		{"pid", &sub.ProductId},
+	} {
+		if s := query.Get(param.name); s != "" {
+			value, err := strconv.ParseUint(s, 16, 16)
+			if err != nil {
+				return sub, fmt.Errorf("invalid %s %q: must be a hexadecimal USB ID", param.name, s)
+			}
+			*param.value = int(value)
+		}
+	}
+
+	sub.SerialNumber = query.Get("serial")
+	sub.PortPath = query.Get("port")
+
+	return sub, sub.validate()
+}
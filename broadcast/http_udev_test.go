@@ -0,0 +1,145 @@
+//go:build linux
+
+package broadcast
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/elemecca/go-hotplug"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// startHandler serves a Handler fed by a Listener for hidraw interfaces
+// from the capture.
+func startHandler(t *testing.T, capture *hotplug.Capture) *httptest.Server {
+	t.Helper()
+
+	handler := NewHandler()
+	l, err := hotplug.New(hotplug.DevIfHid, handler.Add, hotplug.FromCapture(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = l.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Stop() })
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHandlerList(t *testing.T) {
+	server := startHandler(t, loadCapture(t, "hidraw.db", ""))
+
+	for _, test := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"/dev/hidraw0"}},
+		{"?class=hid&vid=046d&pid=C52B", []string{"/dev/hidraw0"}},
+		{"?serial=ABC123&port=1-2", []string{"/dev/hidraw0"}},
+		{"?vid=1234", nil},
+		{"?class=serial,hid", []string{"/dev/hidraw0"}},
+	} {
+		resp, err := http.Get(server.URL + test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var infos []hotplug.InterfaceInfo
+		err = json.NewDecoder(resp.Body).Decode(&infos)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, info := range infos {
+			got = append(got, info.Path)
+		}
+		if strings.Join(got, " ") != strings.Join(test.want, " ") {
+			t.Errorf("%q: got %v, want %v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	server := startHandler(t, loadCapture(t, "hidraw.db", ""))
+
+	for _, test := range []struct {
+		method string
+		query  string
+		want   int
+	}{
+		{http.MethodGet, "?vid=xyz", http.StatusBadRequest},
+		{http.MethodGet, "?class=nonsense", http.StatusBadRequest},
+		{http.MethodPost, "", http.StatusMethodNotAllowed},
+	} {
+		req, err := http.NewRequest(test.method, server.URL+test.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != test.want {
+			t.Errorf("%s %q: got status %d, want %d",
+				test.method, test.query, resp.StatusCode, test.want)
+		}
+	}
+}
+
+func TestHandlerStream(t *testing.T) {
+	server := startHandler(t, loadCapture(t, "hidraw.db", ""))
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"?class=hid", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("got content type %q", resp.Header.Get("Content-Type"))
+	}
+
+	// the snapshot is followed by the synced event
+	var names []string
+	var evt hotplug.Event
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			names = append(names, name)
+			if name == "synced" {
+				break
+			}
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok && evt.Action == "" {
+			err = json.Unmarshal([]byte(data), &evt)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if strings.Join(names, " ") != "arrive synced" {
+		t.Errorf("got events %v, want arrive then synced", names)
+	}
+	if evt.Interface.Path != "/dev/hidraw0" {
+		t.Errorf("got arrival of %q, want hidraw0", evt.Interface.Path)
+	}
+}
@@ -0,0 +1,201 @@
+package broadcast
+
+import (
+	"errors"
+	"github.com/elemecca/go-hotplug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// subscriberQueueSize is the number of events which may be waiting to be
+// sent to a subscriber before it is dropped for being too slow.
+const subscriberQueueSize = 256
+
+// errTooSlow is the reason a subscriber is dropped when its queue is full.
+var errTooSlow = errors.New("client is not reading events quickly enough")
+
+// hub tracks the interfaces which are present and passes their arrivals and
+// removals on to subscribers.
+type hub struct {
+	lock        sync.Mutex
+	closed      bool
+	present     map[string]*presentInterface
+	subscribers map[*subscriber]bool
+}
+
+// presentInterface is the arrival of an interface which is present, along
+// with the DeviceInterface whose removal ends it, which is the most recent
+// one reported for the interface's path.
+type presentInterface struct {
+	devIf *hotplug.DeviceInterface
+	evt   *hotplug.Event
+}
+
+// subscriber receives the events selected by its subscription.
+type subscriber struct {
+	sub   Subscription
+	queue chan *hotplug.Event
+
+	// closing is closed when the subscriber has been dropped, with the
+	// reason in err
+	closing   chan struct{}
+	closeOnce sync.Once
+	err       error
+
+	// onClose, if not nil, is called when the subscriber is dropped
+	onClose func()
+}
+
+func newHub() *hub {
+	return &hub{
+		present:     make(map[string]*presentInterface),
+		subscribers: make(map[*subscriber]bool),
+	}
+}
+
+// add records the arrival of an interface and arranges to record its
+// removal. An interface which is reported again, as Listener.Enumerate
+// does, isn't broadcast a second time.
+func (h *hub) add(devIf *hotplug.DeviceInterface) {
+	evt := &hotplug.Event{
+		Action:    hotplug.ActionArrive,
+		Time:      time.Now(),
+		Interface: devIf.Info(),
+	}
+
+	h.lock.Lock()
+	present := h.present[devIf.Path]
+	if present == nil {
+		h.present[devIf.Path] = &presentInterface{devIf: devIf, evt: evt}
+		h.broadcast(evt)
+	} else if present.devIf == devIf {
+		h.lock.Unlock()
+		return
+	} else {
+		present.devIf = devIf
+	}
+	h.lock.Unlock()
+
+	devIf.WatchRemoval(func() { h.remove(devIf) })
+}
+
+// remove records the removal of an interface, unless it has since been
+// reported again.
+func (h *hub) remove(devIf *hotplug.DeviceInterface) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	present := h.present[devIf.Path]
+	if present == nil || present.devIf != devIf {
+		return
+	}
+
+	delete(h.present, devIf.Path)
+	h.broadcast(&hotplug.Event{
+		Action:    hotplug.ActionRemove,
+		Time:      time.Now(),
+		Interface: present.evt.Interface,
+	})
+}
+
+// broadcast queues an event for each subscriber it is selected by. It must
+// be called with the lock held so that events are queued in order.
+func (h *hub) broadcast(evt *hotplug.Event) {
+	for s := range h.subscribers {
+		if !s.sub.Matches(evt.Interface) {
+			continue
+		}
+
+		select {
+		case s.queue <- evt:
+		default:
+			delete(h.subscribers, s)
+			s.close(errTooSlow)
+		}
+	}
+}
+
+// snapshot lists the arrivals of the present interfaces which the
+// subscription selects, ordered by path. It must be called with the lock
+// held.
+func (h *hub) snapshot(sub *Subscription) []*hotplug.Event {
+	var events []*hotplug.Event
+	for _, present := range h.present {
+		if sub.Matches(present.evt.Interface) {
+			events = append(events, present.evt)
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Interface.Path < events[j].Interface.Path
+	})
+	return events
+}
+
+// interfaces lists the present interfaces which the subscription selects,
+// ordered by path.
+func (h *hub) interfaces(sub *Subscription) []hotplug.InterfaceInfo {
+	h.lock.Lock()
+	events := h.snapshot(sub)
+	h.lock.Unlock()
+
+	infos := make([]hotplug.InterfaceInfo, len(events))
+	for i, evt := range events {
+		infos[i] = evt.Interface
+	}
+	return infos
+}
+
+// subscribe returns the arrivals of the present interfaces which the
+// subscription selects along with a subscriber which receives every
+// subsequent event, so that nothing is missed or seen twice.
+func (h *hub) subscribe(sub Subscription, onClose func()) ([]*hotplug.Event, *subscriber, error) {
+	s := &subscriber{
+		sub:     sub,
+		queue:   make(chan *hotplug.Event, subscriberQueueSize),
+		closing: make(chan struct{}),
+		onClose: onClose,
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.closed {
+		return nil, nil, ErrServerClosed
+	}
+
+	h.subscribers[s] = true
+	return h.snapshot(&sub), s, nil
+}
+
+func (h *hub) unsubscribe(s *subscriber) {
+	h.lock.Lock()
+	delete(h.subscribers, s)
+	h.lock.Unlock()
+}
+
+// close drops all subscribers and refuses new ones.
+func (h *hub) close() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.closed = true
+	for s := range h.subscribers {
+		s.close(ErrServerClosed)
+	}
+	h.subscribers = make(map[*subscriber]bool)
+}
+
+// close drops the subscriber for the given reason, or for no particular
+// reason if it is nil.
+func (s *subscriber) close(err error) {
+	s.closeOnce.Do(func() {
+		s.err = err
+		close(s.closing)
+
+		if s.onClose != nil {
+			s.onClose()
+		}
+	})
+}
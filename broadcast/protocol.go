@@ -0,0 +1,101 @@
+// Package broadcast shares hotplug events with other processes over a Unix
+// domain socket, so that programs which can't use the hotplug package
+// directly can still follow device interfaces as they arrive and are
+// removed.
+//
+// A Server owns the Listeners and accepts connections. A Client connects to
+// a Server and reports interfaces with an API like that of a Listener. A
+// Handler serves the same information over HTTP, as JSON and Server-Sent
+// Events, for web pages.
+//
+// # Protocol
+//
+// Messages in both directions are JSON objects, one per line.
+//
+// After connecting, the client sends a Subscription, which selects the
+// interfaces it is interested in. An empty object selects all of them:
+//
+//	{"classes": ["hid"], "vendor_id": 4660}
+//
+// The server replies with an "event" message with the action "arrive" for
+// each matching interface which is already present, then a "synced"
+// message, and then an "event" message for each subsequent arrival and
+// removal of a matching interface:
+//
+//	{"type": "event", "event": {"action": "arrive", "time": "...", "interface": {...}}}
+//	{"type": "synced"}
+//	{"type": "event", "event": {"action": "remove", "time": "...", "interface": {...}}}
+//
+// The event is a hotplug.Event. A removal carries the same interface
+// details as the arrival, and an interface is only reported as removed if
+// it was reported as present.
+//
+// If the server can't serve the client, for example because the
+// subscription is invalid or the client isn't reading its messages quickly
+// enough, it sends an "error" message and closes the connection:
+//
+//	{"type": "error", "error": "..."}
+package broadcast
+
+import (
+	"github.com/elemecca/go-hotplug"
+)
+
+// The types of Message.
+const (
+	MessageEvent  = "event"
+	MessageSynced = "synced"
+	MessageError  = "error"
+)
+
+// A Message is sent from the server to the client.
+type Message struct {
+	Type  string         `json:"type"`
+	Event *hotplug.Event `json:"event,omitempty"`
+	Error string         `json:"error,omitempty"`
+}
+
+// A Subscription selects the interfaces a client is interested in. Fields
+// which are empty or zero match anything.
+type Subscription struct {
+	// Classes lists the names of the interface classes to report, as
+	// returned by InterfaceClass.String.
+	Classes      []string `json:"classes,omitempty"`
+	VendorId     int      `json:"vendor_id,omitempty"`
+	ProductId    int      `json:"product_id,omitempty"`
+	SerialNumber string   `json:"serial_number,omitempty"`
+	PortPath     string   `json:"port_path,omitempty"`
+}
+
+// Matches reports whether the Subscription selects an interface.
+func (sub *Subscription) Matches(info hotplug.InterfaceInfo) bool {
+	if len(sub.Classes) > 0 {
+		found := false
+		for _, class := range sub.Classes {
+			if class == info.Class {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return (sub.VendorId == 0 || sub.VendorId == info.VendorId) &&
+		(sub.ProductId == 0 || sub.ProductId == info.ProductId) &&
+		(sub.SerialNumber == "" || sub.SerialNumber == info.SerialNumber) &&
+		(sub.PortPath == "" || sub.PortPath == info.PortPath)
+}
+
+// validate checks that the Subscription names known classes.
+func (sub *Subscription) validate() error {
+	for _, class := range sub.Classes {
+		_, err := hotplug.ParseInterfaceClass(class)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,245 @@
+package broadcast
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"github.com/elemecca/go-hotplug"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrServerClosed is returned by Serve and ListenAndServe once the Server
+// has been closed.
+var ErrServerClosed = errors.New("broadcast server closed")
+
+// A Server broadcasts the arrivals and removals reported by its Listeners
+// to the clients connected to it.
+//
+// A Server is safe for concurrent use by multiple goroutines.
+type Server struct {
+	hub       *hub
+	listeners []*hotplug.Listener
+
+	// lock protects the fields below
+	lock      sync.Mutex
+	closed    bool
+	netListen map[net.Listener]bool
+
+	// pending holds the connections which haven't sent their subscription
+	// yet, so that Close can stop waiting for it
+	pending map[net.Conn]bool
+
+	// running counts the goroutines serving clients
+	running sync.WaitGroup
+}
+
+// NewServer creates a Server and starts Listeners for the given interface
+// classes, which report the interfaces selected by the filter. The options
+// are passed to New.
+func NewServer(
+	classes []hotplug.InterfaceClass,
+	filter hotplug.Filter,
+	options ...hotplug.Option,
+) (*Server, error) {
+	s := &Server{
+		hub:       newHub(),
+		netListen: make(map[net.Listener]bool),
+		pending:   make(map[net.Conn]bool),
+	}
+
+	for _, class := range classes {
+		l, err := hotplug.New(class, func(devIf *hotplug.DeviceInterface) {
+			if filter.Matches(devIf) {
+				s.hub.add(devIf)
+			}
+		}, options...)
+		if err == nil {
+			s.listeners = append(s.listeners, l)
+			err = l.Start()
+		}
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// ListenAndServe listens on the Unix domain socket at the given path and
+// serves the clients which connect to it until the Server is closed, after
+// which it removes the socket. A stale socket left behind by a server which
+// is no longer running is replaced.
+func (s *Server) ListenAndServe(socketPath string) error {
+	if _, err := os.Stat(socketPath); err == nil {
+		conn, err := net.Dial("unix", socketPath)
+		if err == nil {
+			conn.Close()
+			return errors.New("a server is already listening on " + socketPath)
+		}
+		os.Remove(socketPath)
+	}
+
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(ln)
+}
+
+// Serve accepts connections from clients on the listener and serves them
+// until the Server is closed. It closes the listener before returning.
+func (s *Server) Serve(ln net.Listener) error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		ln.Close()
+		return ErrServerClosed
+	}
+	s.netListen[ln] = true
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		delete(s.netListen, ln)
+		s.lock.Unlock()
+		ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.lock.Lock()
+			closed := s.closed
+			s.lock.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		s.lock.Lock()
+		if s.closed {
+			s.lock.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.pending[conn] = true
+		s.lock.Unlock()
+
+		s.running.Add(1)
+		go func() {
+			defer s.running.Done()
+			s.serve(conn)
+		}()
+	}
+}
+
+// serve reads the client's subscription and then sends it messages until
+// it disconnects or the Server is closed.
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+
+	encoder := json.NewEncoder(conn)
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+
+	s.lock.Lock()
+	delete(s.pending, conn)
+	s.lock.Unlock()
+
+	if err != nil {
+		return
+	}
+
+	var sub Subscription
+	err = json.Unmarshal(line, &sub)
+	if err == nil {
+		err = sub.validate()
+	}
+	if err != nil {
+		encoder.Encode(&Message{Type: MessageError, Error: "invalid subscription: " + err.Error()})
+		return
+	}
+
+	snapshot, client, err := s.hub.subscribe(sub, func() {
+		// unblock the writer if the client has stopped reading
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+	})
+	if err != nil {
+		encoder.Encode(&Message{Type: MessageError, Error: err.Error()})
+		return
+	}
+	defer s.hub.unsubscribe(client)
+
+	// nothing more is expected from the client, but reading tells us when
+	// it disconnects
+	go func() {
+		for {
+			_, err := reader.ReadBytes('\n')
+			if err != nil {
+				client.close(nil)
+				return
+			}
+		}
+	}()
+
+	for _, evt := range snapshot {
+		err = encoder.Encode(&Message{Type: MessageEvent, Event: evt})
+		if err != nil {
+			return
+		}
+	}
+
+	err = encoder.Encode(&Message{Type: MessageSynced})
+	if err != nil {
+		return
+	}
+
+	for {
+		select {
+		case evt := <-client.queue:
+			err = encoder.Encode(&Message{Type: MessageEvent, Event: evt})
+			if err != nil {
+				return
+			}
+
+		case <-client.closing:
+			if client.err != nil {
+				encoder.Encode(&Message{Type: MessageError, Error: client.err.Error()})
+			}
+			return
+		}
+	}
+}
+
+// Close disconnects all clients, including those which haven't sent their
+// subscription yet, stops accepting connections and stops the Server's
+// Listeners.
+func (s *Server) Close() error {
+	s.hub.close()
+
+	s.lock.Lock()
+	s.closed = true
+	for ln := range s.netListen {
+		ln.Close()
+	}
+	for conn := range s.pending {
+		conn.Close()
+	}
+	s.lock.Unlock()
+
+	var err error
+	for _, l := range s.listeners {
+		if stopErr := l.Stop(); stopErr != nil {
+			err = stopErr
+		}
+	}
+
+	s.running.Wait()
+	return err
+}
@@ -0,0 +1,250 @@
+//go:build linux
+
+package broadcast
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"github.com/elemecca/go-hotplug"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// loadCapture reads a capture from the testdata directory of the hotplug
+// package. The events file is optional.
+func loadCapture(t *testing.T, db string, events string) *hotplug.Capture {
+	t.Helper()
+
+	capture := &hotplug.Capture{}
+	read := func(name string, parse func(f *os.File) error) {
+		f, err := os.Open("../testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		err = parse(f)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %s", name, err.Error())
+		}
+	}
+
+	read(db, func(f *os.File) error { return capture.ReadExportDB(f) })
+	if events != "" {
+		read(events, func(f *os.File) error { return capture.ReadMonitor(f) })
+	}
+
+	return capture
+}
+
+// startServer starts a Server reporting hidraw interfaces from the capture,
+// or none if it is nil, and returns the path of its socket.
+func startServer(t *testing.T, capture *hotplug.Capture) (*Server, string) {
+	t.Helper()
+
+	var classes []hotplug.InterfaceClass
+	if capture != nil {
+		classes = []hotplug.InterfaceClass{hotplug.DevIfHid}
+	}
+
+	s, err := NewServer(classes, nil, hotplug.FromCapture(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	socketPath := filepath.Join(t.TempDir(), "hotplug.sock")
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(ln) }()
+
+	t.Cleanup(func() {
+		s.Close()
+		if err := <-served; err != ErrServerClosed {
+			t.Errorf("got %v from Serve, want ErrServerClosed", err)
+		}
+	})
+
+	return s, socketPath
+}
+
+// startClient starts a Client which sends "arrive PATH" and "remove PATH"
+// to the returned channel as the server reports them.
+func startClient(t *testing.T, socketPath string, options ...ClientOption) (*Client, <-chan string) {
+	t.Helper()
+
+	events := make(chan string, 100)
+	c, err := NewClient(socketPath, Subscription{Classes: []string{"hid"}},
+		func(iface *Interface) {
+			path := iface.Path
+			events <- "arrive " + path
+			iface.OnDetach(func() {
+				events <- "remove " + path
+			})
+		}, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Stop() })
+
+	return c, events
+}
+
+// expectEvents checks that the next events received are the given ones and
+// that no others follow shortly after.
+func expectEvents(t *testing.T, events <-chan string, want ...string) {
+	t.Helper()
+
+	for _, expected := range want {
+		select {
+		case got := <-events:
+			if got != expected {
+				t.Fatalf("got %q, want %q", got, expected)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", expected)
+		}
+	}
+
+	select {
+	case got := <-events:
+		t.Errorf("got unexpected %q", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestServerClient(t *testing.T) {
+	s, socketPath := startServer(t, nil)
+	_, events := startClient(t, socketPath)
+
+	// feed the server once the client is subscribed so that it sees the
+	// events rather than a snapshot
+	l, err := hotplug.New(hotplug.DevIfHid, s.hub.add,
+		hotplug.FromCapture(loadCapture(t, "hidraw.db", "hidraw.events")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = l.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Stop()
+
+	expectEvents(t, events,
+		"arrive /dev/hidraw0",
+		"arrive /dev/hidraw1",
+		"remove /dev/hidraw0",
+		"remove /dev/hidraw1",
+	)
+}
+
+func TestServerSnapshot(t *testing.T) {
+	s, socketPath := startServer(t, loadCapture(t, "hidraw.db", ""))
+	_, events := startClient(t, socketPath)
+	expectEvents(t, events, "arrive /dev/hidraw0")
+
+	// the interface is reported again, which mustn't be broadcast or
+	// appear twice in the snapshot
+	err := s.listeners[0].Enumerate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, events)
+
+	_, events = startClient(t, socketPath)
+	expectEvents(t, events, "arrive /dev/hidraw0")
+}
+
+func TestServerInvalidSubscription(t *testing.T) {
+	_, socketPath := startServer(t, nil)
+
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("{\"classes\": [\"nonsense\"]}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msg Message
+	err = json.NewDecoder(bufio.NewReader(conn)).Decode(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != MessageError {
+		t.Errorf("got %+v, want an error message", msg)
+	}
+}
+
+func TestServerCloseIdleClient(t *testing.T) {
+	s, socketPath := startServer(t, nil)
+
+	// a client which never sends its subscription
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// make sure the connection has been accepted
+	time.Sleep(50 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		s.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close is waiting for the idle client")
+	}
+}
+
+func TestClientRecoversPanics(t *testing.T) {
+	_, socketPath := startServer(t, loadCapture(t, "hidraw.db", ""))
+
+	errs := make(chan error, 1)
+	c, err := NewClient(socketPath, Subscription{}, func(iface *Interface) {
+		panic("oops")
+	}, ClientOnError(func(err error) { errs <- err }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	var panicErr *hotplug.PanicError
+	select {
+	case err = <-errs:
+		if !errors.As(err, &panicErr) || panicErr.Value != "oops" {
+			t.Errorf("got %v, want the panic", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the panic")
+	}
+
+	if c.Err() != nil {
+		t.Errorf("got %v, want the client still connected", c.Err())
+	}
+}
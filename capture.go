@@ -0,0 +1,201 @@
+package hotplug
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Capture is an offline recording of the udev device database and of
+// udev events, as printed by `udevadm info --export-db` and
+// `udevadm monitor --udev --property`.
+//
+// A Listener created with the FromCapture option uses the Capture in place of
+// the live system: Enumerate reports the devices in the database and Listen
+// replays the events in order, updating the database as it goes.
+type Capture struct {
+	Devices []*CapturedDevice
+	Events  []*CapturedEvent
+}
+
+// A CapturedDevice is the udev record of a single device.
+type CapturedDevice struct {
+	// Devpath is the path of the device in sysfs without the /sys prefix.
+	Devpath string
+
+	// Properties holds the udev properties of the device.
+	Properties map[string]string
+
+	// Attributes holds the sysfs attributes of the device, if they were
+	// captured. Neither udevadm format includes attributes, so for the
+	// common ones the matching udev properties are used instead. These
+	// include the PCI class and USB device class, from PCI_CLASS and TYPE,
+	// by which host controllers and hubs are recognised.
+	Attributes map[string]string
+}
+
+// A CapturedEvent is a single event from a udev monitor.
+type CapturedEvent struct {
+	// Source is "UDEV" for events sent after rule processing or "KERNEL"
+	// for raw kernel uevents. Only UDEV events are replayed.
+	Source string
+
+	// Time is the monitor timestamp, which counts from system boot.
+	Time time.Duration
+
+	Action string
+	Seqnum uint64
+	Device *CapturedDevice
+}
+
+func newCapturedDevice(devpath string) *CapturedDevice {
+	return &CapturedDevice{
+		Devpath:    devpath,
+		Properties: make(map[string]string),
+		Attributes: make(map[string]string),
+	}
+}
+
+// ReadExportDB parses the output of `udevadm info --export-db` and adds the
+// devices it describes to the Capture.
+func (c *Capture) ReadExportDB(r io.Reader) error {
+	var dev *CapturedDevice
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			dev = nil
+			continue
+		}
+
+		tag, value, ok := strings.Cut(line, ": ")
+		if !ok || len(tag) != 1 {
+			return errors.New(fmt.Sprintf(
+				"export-db line %d: expected a record line",
+				lineNo,
+			))
+		}
+
+		if tag == "P" {
+			dev = newCapturedDevice(value)
+			c.Devices = append(c.Devices, dev)
+			continue
+		} else if dev == nil {
+			return errors.New(fmt.Sprintf(
+				"export-db line %d: record does not start with P:",
+				lineNo,
+			))
+		}
+
+		switch tag {
+		case "N":
+			setDefault(dev.Properties, "DEVNAME", "/dev/"+value)
+		case "U":
+			setDefault(dev.Properties, "SUBSYSTEM", value)
+		case "T":
+			setDefault(dev.Properties, "DEVTYPE", value)
+		case "V":
+			setDefault(dev.Properties, "DRIVER", value)
+		case "A":
+			key, val, _ := strings.Cut(value, "=")
+			dev.Attributes[key] = val
+		case "E":
+			key, val, _ := strings.Cut(value, "=")
+			dev.Properties[key] = val
+		}
+	}
+
+	return scanner.Err()
+}
+
+var reMonitorHeader = regexp.MustCompile(
+	`^(KERNEL|UDEV)\s*\[\s*([0-9]+(?:\.[0-9]+)?)\]\s+(\S+)\s+(\S+)\s+\((.*)\)$`,
+)
+
+// ReadMonitor parses the output of `udevadm monitor --property` and adds the
+// events it describes to the Capture. Monitor output without --property
+// is accepted, but gives only the action, devpath and subsystem.
+func (c *Capture) ReadMonitor(r io.Reader) error {
+	var evt *CapturedEvent
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			evt = nil
+			continue
+		}
+
+		if match := reMonitorHeader.FindStringSubmatch(line); match != nil {
+			seconds, err := strconv.ParseFloat(match[2], 64)
+			if err != nil {
+				return errors.New(fmt.Sprintf(
+					"monitor line %d: bad timestamp: %s",
+					lineNo, err.Error(),
+				))
+			}
+
+			evt = &CapturedEvent{
+				Source: match[1],
+				Time:   (time.Duration)(seconds * float64(time.Second)),
+				Action: match[3],
+				Device: newCapturedDevice(match[4]),
+			}
+			evt.Device.Properties["ACTION"] = match[3]
+			evt.Device.Properties["DEVPATH"] = match[4]
+			evt.Device.Properties["SUBSYSTEM"] = match[5]
+			c.Events = append(c.Events, evt)
+			continue
+		}
+
+		if evt == nil {
+			// the banner udevadm prints before the first event
+			continue
+		}
+
+		key, val, ok := strings.Cut(line, "=")
+		if !ok {
+			return errors.New(fmt.Sprintf(
+				"monitor line %d: expected KEY=value",
+				lineNo,
+			))
+		}
+		evt.Device.Properties[key] = val
+
+		if key == "SEQNUM" {
+			seqnum, err := strconv.ParseUint(val, 10, 64)
+			if err != nil {
+				return errors.New(fmt.Sprintf(
+					"monitor line %d: bad SEQNUM: %s",
+					lineNo, err.Error(),
+				))
+			}
+			evt.Seqnum = seqnum
+		}
+	}
+
+	return scanner.Err()
+}
+
+func setDefault(m map[string]string, key string, value string) {
+	if _, ok := m[key]; !ok {
+		m[key] = value
+	}
+}
+
+// FromCapture makes a Listener use the given Capture instead of the devices
+// connected to the system. Captures are only supported on Linux.
+func FromCapture(capture *Capture) Option {
+	return func(l *Listener) error {
+		l.capture = capture
+		return nil
+	}
+}
@@ -0,0 +1,123 @@
+package hotplug
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+const (
+	testHidraw0 = "/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.0/0003:046D:C52B.0001/hidraw/hidraw0"
+)
+
+// loadCapture reads a capture from the testdata directory. The events file
+// is optional.
+func loadCapture(t *testing.T, db string, events string) *Capture {
+	t.Helper()
+
+	capture := &Capture{}
+	read := func(name string, parse func(f *os.File) error) {
+		f, err := os.Open("testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		err = parse(f)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %s", name, err.Error())
+		}
+	}
+
+	read(db, func(f *os.File) error { return capture.ReadExportDB(f) })
+	if events != "" {
+		read(events, func(f *os.File) error { return capture.ReadMonitor(f) })
+	}
+
+	return capture
+}
+
+func TestReadExportDB(t *testing.T) {
+	capture := loadCapture(t, "hidraw.db", "")
+
+	if len(capture.Devices) != 7 {
+		t.Fatalf("got %d devices, want 7", len(capture.Devices))
+	}
+
+	hidraw := capture.Devices[6]
+	if hidraw.Devpath != testHidraw0 {
+		t.Errorf("got devpath %s, want %s", hidraw.Devpath, testHidraw0)
+	}
+	for key, want := range map[string]string{
+		"SUBSYSTEM": "hidraw",
+		"DEVNAME":   "/dev/hidraw0",
+	} {
+		if got := hidraw.Properties[key]; got != want {
+			t.Errorf("got %s=%q, want %q", key, got, want)
+		}
+	}
+
+	usb := capture.Devices[3]
+	if got := usb.Properties["DEVNAME"]; got != "/dev/bus/usb/001/005" {
+		t.Errorf("got DEVNAME=%q from the N: line, want /dev/bus/usb/001/005", got)
+	}
+}
+
+func TestReadExportDBErrors(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		err   string
+	}{
+		{"E: SUBSYSTEM=usb\n", "export-db line 1: record does not start with P:"},
+		{"P: /devices/a\nnonsense\n", "export-db line 2: expected a record line"},
+	} {
+		err := (&Capture{}).ReadExportDB(strings.NewReader(test.input))
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%q: got error %v, want %q", test.input, err, test.err)
+		}
+	}
+}
+
+func TestReadMonitor(t *testing.T) {
+	capture := loadCapture(t, "hidraw.db", "hidraw.events")
+
+	if len(capture.Events) != 9 {
+		t.Fatalf("got %d events, want 9", len(capture.Events))
+	}
+
+	kernel := capture.Events[0]
+	if kernel.Source != "KERNEL" || kernel.Action != "add" {
+		t.Errorf("got %s %s for the first event, want KERNEL add", kernel.Source, kernel.Action)
+	}
+
+	removal := capture.Events[6]
+	if removal.Source != "UDEV" || removal.Action != "remove" || removal.Seqnum != 105 {
+		t.Errorf("got %s %s seqnum %d, want UDEV remove seqnum 105",
+			removal.Source, removal.Action, removal.Seqnum)
+	}
+	if removal.Device.Devpath != "/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.0" {
+		t.Errorf("got devpath %s", removal.Device.Devpath)
+	}
+	if got := removal.Device.Properties["DEVTYPE"]; got != "usb_interface" {
+		t.Errorf("got DEVTYPE=%q, want usb_interface", got)
+	}
+	if removal.Time.Seconds() != 1235 {
+		t.Errorf("got time %s, want 1235s", removal.Time)
+	}
+}
+
+func TestReadMonitorErrors(t *testing.T) {
+	header := "UDEV  [1.0] add      /devices/a (usb)\n"
+	for _, test := range []struct {
+		input string
+		err   string
+	}{
+		{header + "SUBSYSTEM\n", "monitor line 2: expected KEY=value"},
+		{header + "SEQNUM=x\n", `monitor line 2: bad SEQNUM: strconv.ParseUint: parsing "x": invalid syntax`},
+	} {
+		err := (&Capture{}).ReadMonitor(strings.NewReader(test.input))
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%q: got error %v, want %q", test.input, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+//go:build linux
+
+package hotplug
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// captureSource is a deviceSource which replays a Capture.
+type captureSource struct {
+	lock    sync.Mutex
+	devices map[string]*CapturedDevice
+	events  []*CapturedEvent
+	next    int
+}
+
+func newCaptureSource(capture *Capture) *captureSource {
+	src := &captureSource{
+		devices: make(map[string]*CapturedDevice),
+		events:  capture.Events,
+	}
+
+	for _, dev := range capture.Devices {
+		src.devices[dev.Devpath] = dev
+	}
+
+	return src
+}
+
+func (src *captureSource) enumerate(cond *deviceCondition) ([]sysDevice, error) {
+	src.lock.Lock()
+	defer src.lock.Unlock()
+
+	var devpaths []string
+	for devpath, record := range src.devices {
+		if record.Properties["SUBSYSTEM"] != cond.subsystem {
+			continue
+		}
+		if cond.devtype != "" && record.Properties["DEVTYPE"] != cond.devtype {
+			continue
+		}
+		devpaths = append(devpaths, devpath)
+	}
+	sort.Strings(devpaths)
+
+	devices := make([]sysDevice, len(devpaths))
+	for i, devpath := range devpaths {
+		devices[i] = &capturedSysDevice{source: src, record: src.devices[devpath]}
+	}
+
+	return devices, nil
+}
+
+func (src *captureSource) monitor(
+	conds []*deviceCondition,
+	sink monitorSink,
+	bufferSize int,
+) (stop func() error, err error) {
+	closeChan := make(chan interface{})
+	doneChan := make(chan interface{})
+
+	go func() {
+		defer close(doneChan)
+		for {
+			select {
+			case <-closeChan:
+				return
+			default:
+			}
+
+			evt := src.nextEvent()
+			if evt == nil {
+				<-closeChan
+				return
+			}
+
+			dev := &capturedSysDevice{
+				source: src,
+				record: evt.Device,
+				act:    evt.Action,
+				seq:    evt.Seqnum,
+			}
+			for _, cond := range conds {
+				if cond.subsystem == dev.subsystem() &&
+					(cond.devtype == "" || cond.devtype == dev.devtype()) {
+					sink.handleEvent(dev)
+					break
+				}
+			}
+
+			if evt.Action == "remove" {
+				src.lock.Lock()
+				delete(src.devices, evt.Device.Devpath)
+				src.lock.Unlock()
+			}
+		}
+	}()
+
+	return func() error {
+		close(closeChan)
+		<-doneChan
+		return nil
+	}, nil
+}
+
+func (src *captureSource) lookup(syspath string) sysDevice {
+	src.lock.Lock()
+	defer src.lock.Unlock()
+
+	record := src.devices[strings.TrimPrefix(syspath, "/sys")]
+	if record == nil {
+		return nil
+	}
+
+	return &capturedSysDevice{source: src, record: record}
+}
+
+func (src *captureSource) children(syspath string) ([]sysDevice, error) {
+	src.lock.Lock()
+	defer src.lock.Unlock()
+
+	devpath := strings.TrimPrefix(syspath, "/sys")
+	if src.devices[devpath] == nil {
+		return nil, errors.New("device is not present")
+	}
+
+	var devpaths []string
+	for child := range src.devices {
+		if src.parentDevpath(child) == devpath {
+			devpaths = append(devpaths, child)
+		}
+	}
+	sort.Strings(devpaths)
+
+	devices := make([]sysDevice, len(devpaths))
+	for i, child := range devpaths {
+		devices[i] = &capturedSysDevice{source: src, record: src.devices[child]}
+	}
+
+	return devices, nil
+}
+
+// parentDevpath returns the devpath of the nearest ancestor of a device which
+// is in the database, or an empty string if there is none. It must be
+// called with the lock held.
+func (src *captureSource) parentDevpath(devpath string) string {
+	for {
+		devpath = path.Dir(devpath)
+		if devpath == "/" || devpath == "." {
+			return ""
+		}
+
+		if src.devices[devpath] != nil {
+			return devpath
+		}
+	}
+}
+
+// nextEvent consumes the next replayable event and applies it to the
+// device database, except for removals, which are applied after delivery
+// so that the device's ancestors can still be found.
+func (src *captureSource) nextEvent() *CapturedEvent {
+	src.lock.Lock()
+	defer src.lock.Unlock()
+
+	for src.next < len(src.events) {
+		evt := src.events[src.next]
+		src.next++
+
+		if evt.Source != "UDEV" {
+			continue
+		}
+
+		if evt.Action != "remove" {
+			src.devices[evt.Device.Devpath] = evt.Device
+		}
+		return evt
+	}
+
+	return nil
+}
+
+// capturedSysDevice is a sysDevice backed by a CapturedDevice.
+type capturedSysDevice struct {
+	source *captureSource
+	record *CapturedDevice
+	act    string
+	seq    uint64
+}
+
+// capturedAttributeProperties maps sysfs attributes to the udev properties
+// which carry the same information, since udevadm does not dump attributes.
+var capturedAttributeProperties = map[string]string{
+	"busnum":    "BUSNUM",
+	"devnum":    "DEVNUM",
+	"idVendor":  "ID_VENDOR_ID",
+	"idProduct": "ID_MODEL_ID",
+	"serial":    "ID_SERIAL_SHORT",
+}
+
+// capturedAttributeDerived maps sysfs attributes to functions which work them
+// out from udev properties that carry them in another format.
+var capturedAttributeDerived = map[string]func(props map[string]string) (string, bool){
+	// PCI_CLASS is the class code in hexadecimal without leading zeroes,
+	// such as C0330, where the attribute is 0x0c0330
+	"class": func(props map[string]string) (string, bool) {
+		class, err := strconv.ParseUint(props["PCI_CLASS"], 16, 24)
+		if err != nil {
+			return "", false
+		}
+		return fmt.Sprintf("0x%06x", class), true
+	},
+
+	// the kernel gives USB devices TYPE=class/subclass/protocol in decimal,
+	// where the attribute is two hexadecimal digits
+	"bDeviceClass": func(props map[string]string) (string, bool) {
+		if props["DEVTYPE"] != "usb_device" {
+			return "", false
+		}
+		class, _, _ := strings.Cut(props["TYPE"], "/")
+		val, err := strconv.ParseUint(class, 10, 8)
+		if err != nil {
+			return "", false
+		}
+		return fmt.Sprintf("%02x", val), true
+	},
+}
+
+func (dev *capturedSysDevice) devpath() string {
+	return dev.record.Devpath
+}
+
+func (dev *capturedSysDevice) syspath() string {
+	return "/sys" + dev.record.Devpath
+}
+
+func (dev *capturedSysDevice) subsystem() string {
+	return dev.record.Properties["SUBSYSTEM"]
+}
+
+func (dev *capturedSysDevice) devtype() string {
+	return dev.record.Properties["DEVTYPE"]
+}
+
+func (dev *capturedSysDevice) driver() string {
+	return dev.record.Properties["DRIVER"]
+}
+
+func (dev *capturedSysDevice) devnode() string {
+	return dev.record.Properties["DEVNAME"]
+}
+
+func (dev *capturedSysDevice) action() string {
+	return dev.act
+}
+
+func (dev *capturedSysDevice) seqnum() uint64 {
+	return dev.seq
+}
+
+// initialized is always true, since neither udevadm format records whether
+// udev had finished processing the device.
+func (dev *capturedSysDevice) initialized() bool {
+	return true
+}
+
+func (dev *capturedSysDevice) parent() sysDevice {
+	dev.source.lock.Lock()
+	defer dev.source.lock.Unlock()
+
+	devpath := dev.source.parentDevpath(dev.record.Devpath)
+	if devpath == "" {
+		return nil
+	}
+
+	return &capturedSysDevice{source: dev.source, record: dev.source.devices[devpath]}
+}
+
+func (dev *capturedSysDevice) property(key string) (string, bool) {
+	val, ok := dev.record.Properties[key]
+	return val, ok
+}
+
+func (dev *capturedSysDevice) sysattr(name string) (string, bool) {
+	if val, ok := dev.record.Attributes[name]; ok {
+		return val, true
+	}
+
+	if key, ok := capturedAttributeProperties[name]; ok {
+		return dev.property(key)
+	}
+
+	if derive, ok := capturedAttributeDerived[name]; ok {
+		return derive(dev.record.Properties)
+	}
+
+	return "", false
+}
@@ -0,0 +1,43 @@
+//go:build linux
+
+package hotplug
+
+import (
+	"testing"
+)
+
+func TestCaptureDerivedAttributes(t *testing.T) {
+	capture := loadCapture(t, "hidraw.db", "")
+
+	devIf, err := Find(DevIfHid, nil, FromCapture(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usb, err := devIf.Device.Up(DevUsbDevice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if class, err := usb.Attribute("bDeviceClass"); err != nil || class != "00" {
+		t.Errorf("got bDeviceClass %q, %v for the device, want 00", class, err)
+	}
+
+	hub, err := devIf.Device.Up(DevUsbHub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hub.Path != "/sys/devices/pci0000:00/0000:00:14.0/usb1" {
+		t.Errorf("got hub %s, want usb1", hub.Path)
+	}
+
+	controller, err := devIf.Device.Up(DevUsbHostController)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if class, err := controller.Attribute("class"); err != nil || class != "0x0c0330" {
+		t.Errorf("got class %q, %v for the controller, want 0x0c0330", class, err)
+	}
+	if _, err := controller.Attribute("bDeviceClass"); err == nil {
+		t.Error("got bDeviceClass for a PCI device")
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/elemecca/go-hotplug"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// execReport is the output of the exec command for each command run.
+type execReport struct {
+	Event    hotplug.Event `json:"event"`
+	Command  []string      `json:"command"`
+	Output   string        `json:"output"`
+	Error    string        `json:"error,omitempty"`
+	Duration float64       `json:"duration"`
+}
+
+func runExec(args []string) error {
+	opts := newOptions("exec", "all", "<command> [arguments]")
+	on := opts.flags.String("on", hotplug.ActionArrive,
+		"comma-separated actions to run the command for (arrive, remove)")
+	timeout := opts.flags.Duration("timeout", 0,
+		"kill the command if it runs longer than this, or zero for no limit")
+	jobs := opts.flags.Int("jobs", 0,
+		"run at most this many commands at once, or zero for no limit")
+	existing := opts.flags.Bool("existing", false,
+		"also run the command for the device interfaces which are already present")
+	quiet := opts.flags.Bool("quiet", false,
+		"only report commands which fail")
+	args, err := opts.parse(args)
+	if err != nil {
+		return err
+	} else if len(args) == 0 {
+		opts.flags.Usage()
+		return errUsage
+	}
+
+	config := hotplug.ExecConfig{
+		Timeout:       *timeout,
+		MaxConcurrent: *jobs,
+	}
+
+	for _, action := range strings.Split(*on, ",") {
+		switch strings.TrimSpace(action) {
+		case hotplug.ActionArrive:
+			config.Arrive = args
+		case hotplug.ActionRemove:
+			config.Remove = args
+		default:
+			return fmt.Errorf("invalid -on action %q", action)
+		}
+	}
+
+	classes, err := opts.classes()
+	if err != nil {
+		return err
+	}
+
+	config.Filter, err = opts.filter()
+	if err != nil {
+		return err
+	}
+
+	listenerOptions, err := opts.listenerOptions()
+	if err != nil {
+		return err
+	}
+
+	p, err := opts.printer()
+	if err != nil {
+		return err
+	}
+
+	// results arrive on the goroutines running the commands
+	var lock sync.Mutex
+	config.Result = func(result *hotplug.ExecResult) {
+		if *quiet && result.Err == nil {
+			return
+		}
+
+		report := execReport{
+			Event:    result.Event,
+			Command:  result.Command,
+			Output:   string(result.Output),
+			Duration: result.Duration.Seconds(),
+		}
+		if result.Err != nil {
+			report.Error = result.Err.Error()
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+		p.printOne(report, func(w io.Writer) {
+			status := "ok"
+			if report.Error != "" {
+				status = report.Error
+			}
+			fmt.Fprintf(w, "%s %s %s: %s\n", report.Event.Time.Format(time.RFC3339Nano),
+				report.Event.Action, describeLine(report.Event.Interface), status)
+			if report.Output != "" {
+				for _, line := range strings.Split(strings.TrimSuffix(report.Output, "\n"), "\n") {
+					fmt.Fprintf(w, "  | %s\n", line)
+				}
+			}
+		})
+	}
+
+	exe, err := hotplug.NewExecutor(config)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var startedLock sync.Mutex
+	started := false
+
+	var listeners []*hotplug.Listener
+	for _, class := range classes {
+		l, err := hotplug.New(class, func(devIf *hotplug.DeviceInterface) {
+			startedLock.Lock()
+			run := started || *existing
+			startedLock.Unlock()
+			if run {
+				exe.Add(devIf)
+			}
+		}, listenerOptions...)
+		if err == nil {
+			listeners = append(listeners, l)
+			err = l.Start()
+		}
+		if err != nil {
+			for _, l := range listeners {
+				l.Stop()
+			}
+			return err
+		}
+	}
+
+	startedLock.Lock()
+	started = true
+	startedLock.Unlock()
+
+	<-ctx.Done()
+
+	var failure error
+	for _, l := range listeners {
+		err = l.Stop()
+		if err != nil {
+			failure = err
+		}
+	}
+
+	// let the commands which are already running finish
+	exe.Wait()
+	return failure
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"github.com/elemecca/go-hotplug"
+	"io"
+	"strings"
+)
+
+// interfaceDetails is the output of the info command.
+type interfaceDetails struct {
+	hotplug.InterfaceInfo
+
+	// Ancestors lists the paths of the ancestors of the interface's Device,
+	// starting with its parent.
+	Ancestors []string `json:"ancestors"`
+}
+
+func runInfo(args []string) error {
+	opts := newOptions("info", "all", "<path>")
+	args, err := opts.parse(args)
+	if err != nil {
+		return err
+	} else if len(args) != 1 {
+		opts.flags.Usage()
+		return errUsage
+	}
+	path := args[0]
+
+	classes, err := opts.classes()
+	if err != nil {
+		return err
+	}
+
+	filter, err := opts.filter()
+	if err != nil {
+		return err
+	}
+
+	listenerOptions, err := opts.listenerOptions()
+	if err != nil {
+		return err
+	}
+
+	p, err := opts.printer()
+	if err != nil {
+		return err
+	}
+
+	var values []interface{}
+	for _, class := range classes {
+		devIfs, err := hotplug.List(class, filter, listenerOptions...)
+		if err != nil {
+			return err
+		}
+
+		for _, devIf := range devIfs {
+			if devIf.Path == path || devIf.Device.Path == path {
+				values = append(values, details(devIf))
+			}
+		}
+	}
+
+	if len(values) == 0 {
+		return fmt.Errorf("no device interface or device found with path %s", path)
+	}
+
+	if p.json || p.template != nil {
+		return p.printList(values, nil)
+	}
+
+	for i, value := range values {
+		if i > 0 {
+			fmt.Fprintln(p.out)
+		}
+		printDetails(p.out, value.(*interfaceDetails))
+	}
+	return nil
+}
+
+func details(devIf *hotplug.DeviceInterface) *interfaceDetails {
+	out := &interfaceDetails{InterfaceInfo: devIf.Info(), Ancestors: []string{}}
+
+	dev := devIf.Device
+	for {
+		parent, err := dev.Parent()
+		if err != nil {
+			break
+		}
+		out.Ancestors = append(out.Ancestors, parent.Path)
+		dev = parent
+	}
+
+	return out
+}
+
+func printDetails(w io.Writer, d *interfaceDetails) {
+	fmt.Fprintf(w, "path:          %s\n", d.Path)
+	fmt.Fprintf(w, "class:         %s\n", d.Class)
+	fmt.Fprintf(w, "device path:   %s\n", d.DevicePath)
+	fmt.Fprintf(w, "device class:  %s\n", d.DeviceClass)
+	if d.VendorId != 0 || d.ProductId != 0 {
+		fmt.Fprintf(w, "vendor id:     %04x\n", d.VendorId)
+		fmt.Fprintf(w, "product id:    %04x\n", d.ProductId)
+	}
+	if d.VendorName != "" {
+		fmt.Fprintf(w, "vendor name:   %s\n", d.VendorName)
+	}
+	if d.ProductName != "" {
+		fmt.Fprintf(w, "product name:  %s\n", d.ProductName)
+	}
+	if d.SerialNumber != "" {
+		fmt.Fprintf(w, "serial number: %s\n", d.SerialNumber)
+	}
+	if d.PortPath != "" {
+		fmt.Fprintf(w, "port path:     %s\n", d.PortPath)
+	}
+	if d.StableID != "" {
+		fmt.Fprintf(w, "stable id:     %s\n", d.StableID)
+	}
+	if d.PortLabel != "" {
+		fmt.Fprintf(w, "port label:    %s\n", d.PortLabel)
+	}
+	if loc := d.PortLocation; loc != nil {
+		if loc.ConnectType != "" {
+			fmt.Fprintf(w, "connect type:  %s\n", loc.ConnectType)
+		}
+		if loc.Panel != "" {
+			fmt.Fprintf(w, "panel:         %s\n", loc.Panel)
+		}
+		if loc.VerticalPosition != "" || loc.HorizontalPosition != "" {
+			fmt.Fprintf(w, "position:      %s\n",
+				strings.TrimSpace(loc.VerticalPosition+" "+loc.HorizontalPosition))
+		}
+		if loc.Dock {
+			fmt.Fprintf(w, "on dock:       yes\n")
+		}
+		if loc.Lid {
+			fmt.Fprintf(w, "on lid:        yes\n")
+		}
+	}
+	if d.BusNumber != 0 || d.Address != 0 {
+		fmt.Fprintf(w, "bus number:    %d\n", d.BusNumber)
+		fmt.Fprintf(w, "address:       %d\n", d.Address)
+	}
+	for _, ancestor := range d.Ancestors {
+		fmt.Fprintf(w, "ancestor:      %s\n", ancestor)
+	}
+}
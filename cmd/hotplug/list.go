@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"github.com/elemecca/go-hotplug"
+	"io"
+)
+
+func runList(args []string) error {
+	opts := newOptions("list", "all", "")
+	args, err := opts.parse(args)
+	if err != nil {
+		return err
+	} else if len(args) != 0 {
+		opts.flags.Usage()
+		return errUsage
+	}
+
+	classes, err := opts.classes()
+	if err != nil {
+		return err
+	}
+
+	filter, err := opts.filter()
+	if err != nil {
+		return err
+	}
+
+	listenerOptions, err := opts.listenerOptions()
+	if err != nil {
+		return err
+	}
+
+	p, err := opts.printer()
+	if err != nil {
+		return err
+	}
+
+	var values []interface{}
+	for _, class := range classes {
+		devIfs, err := hotplug.List(class, filter, listenerOptions...)
+		if err != nil {
+			return err
+		}
+
+		for _, devIf := range devIfs {
+			values = append(values, devIf.Info())
+		}
+	}
+
+	return p.printList(values, func(w io.Writer, value interface{}) {
+		fmt.Fprintln(w, describe(value.(hotplug.InterfaceInfo)))
+	})
+}
@@ -0,0 +1,97 @@
+// Command hotplug lists and monitors the devices connected to the computer.
+//
+// Usage:
+//
+//	hotplug <command> [flags] [arguments]
+//
+// Run "hotplug help" for the list of commands and "hotplug <command> -h" for
+// the flags each accepts.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+type command struct {
+	summary string
+	run     func(args []string) error
+}
+
+var commands = map[string]*command{
+	"list": {
+		summary: "list the device interfaces which are present",
+		run:     runList,
+	},
+	"info": {
+		summary: "show the details of the device interface or device with a path",
+		run:     runInfo,
+	},
+	"tree": {
+		summary: "show the device interfaces which are present as a device tree",
+		run:     runTree,
+	},
+	"monitor": {
+		summary: "print device interfaces as they arrive and are removed",
+		run:     runMonitor,
+	},
+	"exec": {
+		summary: "run a command as device interfaces arrive or are removed",
+		run:     runExec,
+	},
+	"serve": {
+		summary: "broadcast device interface events to clients on a Unix domain socket",
+		run:     runServe,
+	},
+	"udev-rule": {
+		summary: "generate a udev rule setting the permissions of a device",
+		run:     runUdevRule,
+	},
+	"wait": {
+		summary: "wait for a device interface to arrive or be removed",
+		run:     runWait,
+	},
+}
+
+// errUsage indicates that the command line was invalid and the usage message
+// has already been printed.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "help" || os.Args[1] == "-h" {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	cmd := commands[name]
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "hotplug: unknown command %q\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	err := cmd.run(os.Args[2:])
+	if errors.Is(err, errUsage) {
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "hotplug %s: %s\n", name, err.Error())
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: hotplug <command> [flags] [arguments]\n\ncommands:\n")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].summary)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/elemecca/go-hotplug"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+func runMonitor(args []string) error {
+	opts := newOptions("monitor", "all", "")
+	existing := opts.flags.Bool("existing", false,
+		"also print the device interfaces which are already present")
+	args, err := opts.parse(args)
+	if err != nil {
+		return err
+	} else if len(args) != 0 {
+		opts.flags.Usage()
+		return errUsage
+	}
+
+	classes, err := opts.classes()
+	if err != nil {
+		return err
+	}
+
+	filter, err := opts.filter()
+	if err != nil {
+		return err
+	}
+
+	listenerOptions, err := opts.listenerOptions()
+	if err != nil {
+		return err
+	}
+
+	p, err := opts.printer()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// events from different classes arrive on different goroutines
+	var lock sync.Mutex
+	var failure error
+	started := false
+
+	print := func(action string, info hotplug.InterfaceInfo) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		evt := hotplug.Event{Action: action, Time: time.Now(), Interface: info}
+		err := p.printOne(evt, func(w io.Writer) {
+			fmt.Fprintf(w, "%s %s %s\n", evt.Time.Format(time.RFC3339Nano), action,
+				describeLine(info))
+		})
+		if err != nil && failure == nil {
+			failure = err
+			stop()
+		}
+	}
+
+	var listeners []*hotplug.Listener
+	defer func() {
+		for _, l := range listeners {
+			l.Stop()
+		}
+	}()
+
+	for _, class := range classes {
+		l, err := hotplug.New(class, func(devIf *hotplug.DeviceInterface) {
+			if !filter.Matches(devIf) {
+				return
+			}
+
+			info := devIf.Info()
+
+			lock.Lock()
+			report := started || *existing
+			lock.Unlock()
+			if !report {
+				// nothing is printed about it leaving either, since its
+				// arrival was never printed
+				return
+			}
+
+			print(hotplug.ActionArrive, info)
+			devIf.OnDetach(func() {
+				print(hotplug.ActionRemove, info)
+			})
+		}, listenerOptions...)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, l)
+	}
+
+	for _, l := range listeners {
+		err = l.Start()
+		if err != nil {
+			return err
+		}
+	}
+
+	lock.Lock()
+	started = true
+	lock.Unlock()
+
+	<-ctx.Done()
+
+	lock.Lock()
+	defer lock.Unlock()
+	return failure
+}
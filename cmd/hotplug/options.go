@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/elemecca/go-hotplug"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+)
+
+// options holds the flags shared by the commands.
+type options struct {
+	flags   *flag.FlagSet
+	class   string
+	vendor  string
+	product string
+	serial  string
+	port    string
+	id      string
+	match   string
+	format  string
+	db      string
+	events  string
+	labels  string
+}
+
+func newOptions(name string, defaultClass string, usage string) *options {
+	opts := &options{flags: flag.NewFlagSet(name, flag.ContinueOnError)}
+
+	opts.flags.Usage = func() {
+		fmt.Fprintf(opts.flags.Output(), "usage: hotplug %s [flags] %s\n", name, usage)
+		opts.flags.PrintDefaults()
+	}
+
+	opts.flags.StringVar(&opts.class, "class", defaultClass,
+		"comma-separated interface classes, or \"all\" ("+classNames()+")")
+	opts.flags.StringVar(&opts.vendor, "vid", "",
+		"only USB devices with this hexadecimal vendor ID")
+	opts.flags.StringVar(&opts.product, "pid", "",
+		"only USB devices with this hexadecimal product ID (requires -vid)")
+	opts.flags.StringVar(&opts.serial, "serial", "",
+		"only USB devices with this serial number")
+	opts.flags.StringVar(&opts.port, "port", "",
+		"only USB devices connected through this port path")
+	opts.flags.StringVar(&opts.id, "id", "",
+		"only USB devices with this stable ID")
+	opts.flags.StringVar(&opts.match, "match", "",
+		"only device interfaces selected by this filter expression, e.g. 'usb.vid == 0x1234'")
+	opts.flags.StringVar(&opts.format, "format", "",
+		"output format: empty for text, \"json\", or a Go template")
+	opts.flags.StringVar(&opts.db, "db", "",
+		"use this `udevadm info --export-db` capture instead of the system")
+	opts.flags.StringVar(&opts.events, "events", "",
+		"replay this `udevadm monitor --property` capture (requires -db)")
+	opts.flags.StringVar(&opts.labels, "labels", "",
+		"label ports using this file of port paths and labels")
+
+	return opts
+}
+
+func classNames() string {
+	var names []string
+	for _, class := range hotplug.InterfaceClasses() {
+		names = append(names, class.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+// parse parses the command line, returning the positional arguments, and
+// loads the port labels if a file of them was given.
+func (opts *options) parse(args []string) ([]string, error) {
+	err := opts.flags.Parse(args)
+	if err != nil {
+		return nil, errUsage
+	}
+
+	if opts.labels != "" {
+		labels, err := hotplug.LoadPortLabels(opts.labels)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load port labels: %w", err)
+		}
+		hotplug.SetPortLabels(labels)
+	}
+
+	return opts.flags.Args(), nil
+}
+
+func (opts *options) classes() ([]hotplug.InterfaceClass, error) {
+	if opts.class == "all" {
+		return hotplug.InterfaceClasses(), nil
+	}
+
+	var classes []hotplug.InterfaceClass
+	for _, name := range strings.Split(opts.class, ",") {
+		class, err := hotplug.ParseInterfaceClass(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		classes = append(classes, class)
+	}
+
+	return classes, nil
+}
+
+func (opts *options) filter() (hotplug.Filter, error) {
+	var filters []hotplug.Filter
+
+	if opts.vendor != "" {
+		vendorId, err := strconv.ParseInt(opts.vendor, 16, 32)
+		if err != nil {
+			return nil, errors.New("invalid -vid: " + err.Error())
+		}
+
+		productId := int64(-1)
+		if opts.product != "" {
+			productId, err = strconv.ParseInt(opts.product, 16, 32)
+			if err != nil {
+				return nil, errors.New("invalid -pid: " + err.Error())
+			}
+		}
+
+		filters = append(filters, hotplug.MatchVendorProduct(int(vendorId), int(productId)))
+	} else if opts.product != "" {
+		return nil, errors.New("-pid requires -vid")
+	}
+
+	if opts.serial != "" {
+		filters = append(filters, hotplug.MatchSerial(opts.serial))
+	}
+
+	if opts.port != "" {
+		filters = append(filters, hotplug.MatchPortPath(opts.port))
+	}
+
+	if opts.id != "" {
+		filters = append(filters, hotplug.MatchStableID(opts.id))
+	}
+
+	if opts.match != "" {
+		filter, err := hotplug.ParseFilter(opts.match)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+
+	return hotplug.MatchAll(filters...), nil
+}
+
+// listenerOptions returns the Options for Listeners, which select a capture
+// if one was given.
+func (opts *options) listenerOptions() ([]hotplug.Option, error) {
+	if opts.db == "" {
+		if opts.events != "" {
+			return nil, errors.New("-events requires -db")
+		}
+		return nil, nil
+	}
+
+	capture := &hotplug.Capture{}
+
+	err := readFile(opts.db, capture.ReadExportDB)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.events != "" {
+		err = readFile(opts.events, capture.ReadMonitor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return []hotplug.Option{hotplug.FromCapture(capture)}, nil
+}
+
+func readFile(name string, read func(r io.Reader) error) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return read(file)
+}
+
+// printer writes values in the format selected by the -format flag.
+type printer struct {
+	out      io.Writer
+	json     bool
+	template *template.Template
+}
+
+func (opts *options) printer() (*printer, error) {
+	p := &printer{out: os.Stdout}
+
+	switch opts.format {
+	case "":
+	case "json":
+		p.json = true
+	default:
+		tmpl, err := template.New("format").Parse(opts.format)
+		if err != nil {
+			return nil, errors.New("invalid -format: " + err.Error())
+		}
+		p.template = tmpl
+	}
+
+	return p, nil
+}
+
+// printOne writes a single value, using the text function for text output.
+func (p *printer) printOne(value interface{}, text func(w io.Writer)) error {
+	if p.json {
+		return json.NewEncoder(p.out).Encode(value)
+	} else if p.template != nil {
+		err := p.template.Execute(p.out, value)
+		if err == nil {
+			_, err = fmt.Fprintln(p.out)
+		}
+		return err
+	}
+
+	text(p.out)
+	return nil
+}
+
+// printList writes a list of values. JSON output is a single array, and
+// text output is aligned in columns.
+func (p *printer) printList(values []interface{}, text func(w io.Writer, value interface{})) error {
+	if p.json {
+		if values == nil {
+			values = []interface{}{}
+		}
+		encoder := json.NewEncoder(p.out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(values)
+	} else if p.template != nil {
+		for _, value := range values {
+			err := p.printOne(value, nil)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(p.out, 0, 8, 2, ' ', 0)
+	for _, value := range values {
+		text(w, value)
+	}
+	return w.Flush()
+}
+
+// describe formats the details of an interface as a line of text, with tabs
+// between the columns.
+func describe(info hotplug.InterfaceInfo) string {
+	var usb string
+	if info.VendorId != 0 || info.ProductId != 0 {
+		usb = fmt.Sprintf("%04x:%04x", info.VendorId, info.ProductId)
+	}
+
+	extra := ""
+	if name := strings.TrimSpace(info.VendorName + " " + info.ProductName); name != "" {
+		extra += fmt.Sprintf(" name=%q", name)
+	}
+	if info.SerialNumber != "" {
+		extra += " serial=" + info.SerialNumber
+	}
+	if info.PortPath != "" {
+		extra += " port=" + info.PortPath
+	}
+	if info.PortLabel != "" {
+		extra += fmt.Sprintf(" label=%q", info.PortLabel)
+	}
+
+	return fmt.Sprintf("%s\t%s\t%s\t%s", info.Class, info.Path, usb, strings.TrimSpace(extra))
+}
+
+// describeLine formats the details of an interface as a line of text for
+// output which isn't aligned in columns.
+func describeLine(info hotplug.InterfaceInfo) string {
+	return strings.Join(strings.Fields(describe(info)), " ")
+}
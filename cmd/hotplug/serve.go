@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/elemecca/go-hotplug/broadcast"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+)
+
+func runServe(args []string) error {
+	opts := newOptions("serve", "all", "")
+
+	// the socket lives in the user's private runtime directory by default,
+	// rather than somewhere other users could take its name
+	defaultSocket := ""
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		defaultSocket = filepath.Join(dir, "hotplug.sock")
+	}
+	socketPath := opts.flags.String("socket", defaultSocket,
+		"listen for clients on the Unix domain socket at this path, which is required if $XDG_RUNTIME_DIR isn't set")
+	httpAddr := opts.flags.String("http", "",
+		"also serve the device interfaces over HTTP at this address, e.g. localhost:8080")
+	args, err := opts.parse(args)
+	if err != nil {
+		return err
+	} else if len(args) != 0 {
+		opts.flags.Usage()
+		return errUsage
+	} else if *socketPath == "" {
+		return errors.New("$XDG_RUNTIME_DIR isn't set; give the socket path with -socket")
+	}
+
+	classes, err := opts.classes()
+	if err != nil {
+		return err
+	}
+
+	filter, err := opts.filter()
+	if err != nil {
+		return err
+	}
+
+	listenerOptions, err := opts.listenerOptions()
+	if err != nil {
+		return err
+	}
+
+	server, err := broadcast.NewServer(classes, filter, listenerOptions...)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	var httpServer *http.Server
+	if *httpAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/devices", server.Handler())
+		httpServer = &http.Server{Addr: *httpAddr, Handler: mux}
+
+		go func() {
+			err := httpServer.ListenAndServe()
+			if err != http.ErrServerClosed {
+				fmt.Fprintf(os.Stderr, "hotplug serve: %s\n", err.Error())
+				stop()
+			}
+		}()
+		defer httpServer.Close()
+	}
+
+	err = server.ListenAndServe(*socketPath)
+	if err == broadcast.ErrServerClosed {
+		return nil
+	}
+	server.Close()
+	return err
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/elemecca/go-hotplug"
+	"io"
+	"strings"
+)
+
+func runTree(args []string) error {
+	opts := newOptions("tree", "all", "")
+	dot := opts.flags.Bool("dot", false, "write the tree as a Graphviz graph")
+	root := opts.flags.String("root", "", "only show the tree below the device with this `path`, or below the device providing the interface with this path")
+	args, err := opts.parse(args)
+	if err != nil {
+		return err
+	} else if len(args) != 0 {
+		opts.flags.Usage()
+		return errUsage
+	}
+
+	classes, err := opts.classes()
+	if err != nil {
+		return err
+	}
+
+	filter, err := opts.filter()
+	if err != nil {
+		return err
+	}
+
+	listenerOptions, err := opts.listenerOptions()
+	if err != nil {
+		return err
+	}
+
+	p, err := opts.printer()
+	if err != nil {
+		return err
+	}
+
+	topology, err := hotplug.BuildTopology(classes, filter, listenerOptions...)
+	if err != nil {
+		return err
+	}
+
+	if *root != "" {
+		node := findNode(topology.Roots, *root)
+		if node == nil {
+			return errors.New("no device or interface found with path " + *root)
+		}
+
+		topology, err = hotplug.BuildTopologyBelow(node.Device, classes, filter)
+		if err != nil {
+			return err
+		}
+	}
+
+	if *dot {
+		return topology.WriteDOT(p.out)
+	}
+
+	values := make([]interface{}, len(topology.Roots))
+	for i, root := range topology.Roots {
+		values[i] = root
+	}
+
+	if p.json || p.template != nil {
+		return p.printList(values, nil)
+	}
+
+	for _, root := range topology.Roots {
+		printTree(p.out, root, 0)
+	}
+	return nil
+}
+
+func printTree(w io.Writer, node *hotplug.TopologyNode, depth int) {
+	indent := strings.Repeat("  ", depth)
+	fmt.Fprintf(w, "%s%s (%s)", indent, node.Path, node.Class)
+	if node.PortPath != "" {
+		fmt.Fprintf(w, " port=%s", node.PortPath)
+	}
+	fmt.Fprintln(w)
+
+	for _, info := range node.Interfaces {
+		fmt.Fprintf(w, "%s  * %s\n", indent, describeLine(info))
+	}
+
+	for _, child := range node.Children {
+		printTree(w, child, depth+1)
+	}
+}
+
+// findNode finds the node of the device with the given path, or of the device
+// providing the interface with the given path.
+func findNode(nodes []*hotplug.TopologyNode, path string) *hotplug.TopologyNode {
+	for _, node := range nodes {
+		if node.Path == path {
+			return node
+		}
+
+		for _, info := range node.Interfaces {
+			if info.Path == path {
+				return node
+			}
+		}
+
+		if found := findNode(node.Children, path); found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/elemecca/go-hotplug"
+	"io"
+	"os"
+)
+
+type udevRuleReport struct {
+	Interface hotplug.InterfaceInfo `json:"interface"`
+	Rule      string                `json:"rule"`
+	Applies   []string              `json:"applies"`
+}
+
+func runUdevRule(args []string) error {
+	opts := newOptions("udev-rule", "all", "<path>")
+	match := opts.flags.String("by", "auto",
+		"how to tell the device apart: \"model\", \"serial\", \"port\", or \"auto\" for serial if it has one and port otherwise")
+	mode := opts.flags.String("mode", "", "set the device node's permissions, e.g. 0660")
+	group := opts.flags.String("group", "", "set the device node's group")
+	uaccess := opts.flags.Bool("uaccess", false, "grant access to the user logged in at the seat")
+	symlink := opts.flags.String("symlink", "", "create a symbolic link to the device node under /dev")
+	args, err := opts.parse(args)
+	if err != nil {
+		return err
+	} else if len(args) != 1 {
+		opts.flags.Usage()
+		return errUsage
+	}
+	path := args[0]
+
+	ruleOptions := hotplug.UdevRuleOptions{
+		Mode:    *mode,
+		Group:   *group,
+		Uaccess: *uaccess,
+		Symlink: *symlink,
+	}
+
+	var matches []hotplug.UdevMatch
+	switch *match {
+	case "auto":
+		matches = []hotplug.UdevMatch{hotplug.UdevMatchSerial, hotplug.UdevMatchPort}
+	case "model":
+		matches = []hotplug.UdevMatch{hotplug.UdevMatchModel}
+	case "serial":
+		matches = []hotplug.UdevMatch{hotplug.UdevMatchSerial}
+	case "port":
+		matches = []hotplug.UdevMatch{hotplug.UdevMatchPort}
+	default:
+		return fmt.Errorf("invalid -by %q", *match)
+	}
+
+	classes, err := opts.classes()
+	if err != nil {
+		return err
+	}
+
+	filter, err := opts.filter()
+	if err != nil {
+		return err
+	}
+
+	listenerOptions, err := opts.listenerOptions()
+	if err != nil {
+		return err
+	}
+
+	p, err := opts.printer()
+	if err != nil {
+		return err
+	}
+
+	// a rule for an interface applies to its device node, and one for a
+	// device to the device itself
+	var target *hotplug.DeviceInterface
+	for _, class := range classes {
+		devIfs, err := hotplug.List(class, filter, listenerOptions...)
+		if err != nil {
+			return err
+		}
+
+		for _, devIf := range devIfs {
+			if devIf.Path == path || devIf.Device.Path == path {
+				target = devIf
+				break
+			}
+		}
+		if target != nil {
+			break
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("no device interface or device found with path %s", path)
+	}
+
+	var rule *hotplug.UdevRule
+	for _, ruleOptions.Match = range matches {
+		if target.Path == path {
+			rule, err = hotplug.NewInterfaceUdevRule(target, ruleOptions)
+		} else {
+			rule, err = hotplug.NewUdevRule(target.Device, ruleOptions)
+		}
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	applies, err := rule.Validate(listenerOptions...)
+	if err != nil {
+		return errors.New("generated rule failed validation: " + err.Error())
+	}
+
+	report := udevRuleReport{Interface: target.Info(), Rule: rule.String(), Applies: []string{}}
+	for _, dev := range applies {
+		report.Applies = append(report.Applies, dev.Path)
+	}
+
+	err = p.printOne(report, func(w io.Writer) {
+		fmt.Fprintf(w, "# %s\n%s\n", describeLine(report.Interface), report.Rule)
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(applies) > 1 {
+		fmt.Fprintf(os.Stderr, "warning: the rule applies to %d devices which are present:\n", len(applies))
+		for _, dev := range applies {
+			fmt.Fprintf(os.Stderr, "  %s\n", dev.Path)
+		}
+	}
+
+	return nil
+}
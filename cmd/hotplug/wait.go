@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/elemecca/go-hotplug"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func runWait(args []string) error {
+	opts := newOptions("wait", "hid", "")
+	timeout := opts.flags.Duration("timeout", 0,
+		"give up after this long, or zero to wait forever")
+	removed := opts.flags.Bool("removed", false,
+		"wait until no matching device interface is present instead")
+	args, err := opts.parse(args)
+	if err != nil {
+		return err
+	} else if len(args) != 0 {
+		opts.flags.Usage()
+		return errUsage
+	}
+
+	classes, err := opts.classes()
+	if err != nil {
+		return err
+	} else if len(classes) != 1 {
+		return errors.New("-class must name exactly one interface class")
+	}
+
+	filter, err := opts.filter()
+	if err != nil {
+		return err
+	}
+
+	listenerOptions, err := opts.listenerOptions()
+	if err != nil {
+		return err
+	}
+
+	p, err := opts.printer()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	if *removed {
+		err = hotplug.WaitForRemoval(ctx, classes[0], filter, listenerOptions...)
+		if errors.Is(err, context.DeadlineExceeded) {
+			return errors.New("timed out")
+		}
+		return err
+	}
+
+	devIf, err := hotplug.WaitFor(ctx, classes[0], filter, listenerOptions...)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errors.New("timed out")
+	} else if err != nil {
+		return err
+	}
+
+	info := devIf.Info()
+	return p.printOne(info, func(w io.Writer) {
+		fmt.Fprintln(w, describeLine(info))
+	})
+}
@@ -25,7 +25,7 @@ import "C"
 // provided as a slice of WCHAR to a slice of strings each of which is a slice
 // of WCHAR including one null termination.
 func splitUTF16StringList(list []uint16) [][]uint16 {
-	out := make([][]uint16, 10)
+	out := make([][]uint16, 0, 10)
 	tail := list
 	for {
 		nextNull := slices.Index(tail, 0)
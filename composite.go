@@ -0,0 +1,345 @@
+package hotplug
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultSettleTime is a settle window long enough for the interfaces of
+// most composite USB devices to arrive. It allows for the disks of USB mass
+// storage interfaces, which Linux only probes once the usb-storage driver's
+// delay_use time, a second by default, has passed.
+const DefaultSettleTime = 2 * time.Second
+
+type CompositeCallback func(c *Composite)
+
+// A Composite is a device along with all of its interfaces of the classes a
+// CompositeListener reports, such as the HID, serial and disk interfaces of
+// a composite USB device.
+//
+// The interfaces of a Composite don't change. If an interface of the device
+// is removed, or another one arrives, the Composite is removed and, once the
+// device has settled, replaced by a new one with the interfaces which are
+// then present.
+type Composite struct {
+	// Device is the USB device providing the interfaces, or for an
+	// interface which isn't provided by a USB device, the interface's own
+	// Device.
+	Device *Device
+
+	// Interfaces are sorted as List sorts them.
+	Interfaces []*DeviceInterface
+
+	listener *CompositeListener
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+
+	// inArrive is set while the arrive callback runs. It and detachCb are
+	// protected by the CompositeListener's lock, since OnDetach may be
+	// called from any goroutine.
+	inArrive bool
+	detachCb []func()
+}
+
+// Classes returns the classes of the Composite's interfaces, without
+// repeats.
+func (c *Composite) Classes() []InterfaceClass {
+	var classes []InterfaceClass
+	seen := make(map[InterfaceClass]bool)
+	for _, devIf := range c.Interfaces {
+		if !seen[devIf.Class] {
+			seen[devIf.Class] = true
+			classes = append(classes, devIf.Class)
+		}
+	}
+
+	sort.Slice(classes, func(i, j int) bool {
+		return classes[i] < classes[j]
+	})
+	return classes
+}
+
+// OnDetach registers a callback to be called when the Composite is removed.
+// It must be called while the arrive callback is running, usually from the
+// callback itself, though it may be called from any goroutine.
+func (c *Composite) OnDetach(callback func()) error {
+	c.listener.lock.Lock()
+	defer c.listener.lock.Unlock()
+
+	if !c.inArrive {
+		return errors.New("OnDetach must be called from the arrive callback")
+	}
+
+	c.detachCb = append(c.detachCb, callback)
+	return nil
+}
+
+// Done returns a channel which is closed when the Composite is removed or
+// the CompositeListener which reported it is stopped.
+func (c *Composite) Done() <-chan struct{} {
+	return c.ctx.Done()
+}
+
+// Context returns a context which is cancelled when the Composite is removed
+// or the CompositeListener which reported it is stopped. Its cause is
+// ErrRemoved or ErrStopped respectively.
+func (c *Composite) Context() context.Context {
+	return c.ctx
+}
+
+// compositeGroup collects the interfaces of one device.
+type compositeGroup struct {
+	device  *Device
+	members map[*DeviceInterface]bool
+	timer   *time.Timer
+
+	// generation identifies the current settle window
+	generation int
+
+	// current is the Composite reported for the group, if any
+	current *Composite
+}
+
+// A CompositeListener reports devices along with their interfaces of several
+// classes, rather than reporting each interface separately as a Listener
+// does.
+//
+// Interfaces are grouped by the USB device which provides them. The
+// interfaces of a device arrive one by one, so a device is only reported
+// once no more of its interfaces have arrived for the settle time: each
+// interface which arrives starts the settle time again.
+//
+// The callbacks, including detach callbacks, are called one at a time.
+type CompositeListener struct {
+	callback  CompositeCallback
+	settle    time.Duration
+	listeners []*Listener
+
+	// deliverLock serializes the callbacks
+	deliverLock sync.Mutex
+
+	// lock protects the fields below
+	lock    sync.Mutex
+	stopped bool
+	groups  map[string]*compositeGroup
+}
+
+// NewCompositeListener creates a CompositeListener for the given classes of
+// interface. A settle time of zero means DefaultSettleTime. The options are
+// passed to New.
+func NewCompositeListener(
+	classes []InterfaceClass,
+	settle time.Duration,
+	callback CompositeCallback,
+	options ...Option,
+) (*CompositeListener, error) {
+	if len(classes) == 0 {
+		return nil, errors.New("no interface classes given")
+	}
+	if settle < 0 {
+		return nil, errors.New("settle time must not be negative")
+	}
+	if settle == 0 {
+		settle = DefaultSettleTime
+	}
+
+	cl := &CompositeListener{
+		callback: callback,
+		settle:   settle,
+		groups:   make(map[string]*compositeGroup),
+	}
+
+	for _, class := range classes {
+		l, err := New(class, cl.arrive, options...)
+		if err != nil {
+			return nil, err
+		}
+		cl.listeners = append(cl.listeners, l)
+	}
+
+	return cl, nil
+}
+
+// Start reports the devices which are present and then each device as it
+// is connected, as Listener.Start does.
+func (cl *CompositeListener) Start() error {
+	cl.lock.Lock()
+	cl.stopped = false
+	cl.lock.Unlock()
+
+	for _, l := range cl.listeners {
+		err := l.Start()
+		if err != nil {
+			cl.Stop()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Stop stops listening for events and cancels the contexts of the reported
+// Composites. Devices which were still settling are not reported. It must
+// not be called from a callback.
+func (cl *CompositeListener) Stop() error {
+	var err error
+	for _, l := range cl.listeners {
+		if stopErr := l.Stop(); stopErr != nil && err == nil {
+			err = stopErr
+		}
+	}
+
+	cl.deliverLock.Lock()
+	defer cl.deliverLock.Unlock()
+
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+
+	cl.stopped = true
+	for key, group := range cl.groups {
+		group.timer.Stop()
+		if group.current != nil {
+			group.current.cancel(ErrStopped)
+		}
+		delete(cl.groups, key)
+	}
+
+	return err
+}
+
+// arrive adds an interface to the group of its device and restarts the
+// group's settle window.
+func (cl *CompositeListener) arrive(devIf *DeviceInterface) {
+	device, err := devIf.Device.usbDevice()
+	if err != nil {
+		device = devIf.Device
+	}
+	key := device.Path
+
+	cl.deliverLock.Lock()
+	defer cl.deliverLock.Unlock()
+
+	cl.lock.Lock()
+	if cl.stopped {
+		cl.lock.Unlock()
+		return
+	}
+
+	group := cl.groups[key]
+	if group == nil {
+		group = &compositeGroup{
+			device:  device,
+			members: make(map[*DeviceInterface]bool),
+		}
+		cl.groups[key] = group
+	}
+	cl.wait(key, group)
+	group.members[devIf] = true
+	retired := group.current
+	group.current = nil
+	cl.lock.Unlock()
+
+	cl.detach(retired)
+
+	devIf.OnDetach(func() { cl.remove(key, devIf) })
+}
+
+// remove takes an interface out of the group of its device.
+func (cl *CompositeListener) remove(key string, devIf *DeviceInterface) {
+	cl.deliverLock.Lock()
+	defer cl.deliverLock.Unlock()
+
+	cl.lock.Lock()
+	group := cl.groups[key]
+	if group == nil || !group.members[devIf] {
+		cl.lock.Unlock()
+		return
+	}
+
+	delete(group.members, devIf)
+	if len(group.members) == 0 {
+		group.timer.Stop()
+		delete(cl.groups, key)
+	} else {
+		cl.wait(key, group)
+	}
+	retired := group.current
+	group.current = nil
+	cl.lock.Unlock()
+
+	cl.detach(retired)
+}
+
+// wait starts a new settle window for a group. It must be called with the
+// lock held.
+func (cl *CompositeListener) wait(key string, group *compositeGroup) {
+	if group.timer != nil {
+		group.timer.Stop()
+	}
+
+	group.generation++
+	generation := group.generation
+	group.timer = time.AfterFunc(cl.settle, func() {
+		cl.settled(key, group, generation)
+	})
+}
+
+// settled reports a group once its settle window has passed.
+func (cl *CompositeListener) settled(key string, group *compositeGroup, generation int) {
+	cl.deliverLock.Lock()
+	defer cl.deliverLock.Unlock()
+
+	// the window may have been restarted, or the group removed, while
+	// waiting for the lock
+	cl.lock.Lock()
+	if cl.groups[key] != group || group.generation != generation {
+		cl.lock.Unlock()
+		return
+	}
+
+	c := &Composite{Device: group.device, listener: cl}
+	for devIf := range group.members {
+		c.Interfaces = append(c.Interfaces, devIf)
+	}
+	sortInterfaces(c.Interfaces)
+	c.ctx, c.cancel = context.WithCancelCause(context.Background())
+	group.current = c
+	c.inArrive = true
+	cl.lock.Unlock()
+
+	cl.protect(func() { cl.callback(c) })
+
+	cl.lock.Lock()
+	c.inArrive = false
+	cl.lock.Unlock()
+}
+
+// detach runs the detach callbacks of a Composite which has been removed, if
+// any. It must be called with the deliverLock held.
+func (cl *CompositeListener) detach(c *Composite) {
+	if c == nil {
+		return
+	}
+
+	c.cancel(ErrRemoved)
+
+	cl.lock.Lock()
+	callbacks := c.detachCb
+	c.detachCb = nil
+	cl.lock.Unlock()
+
+	for _, callback := range callbacks {
+		if callback != nil {
+			cl.protect(callback)
+		}
+	}
+}
+
+// protect runs a callback, recovering from and reporting any panic through
+// the Listeners' error handler.
+func (cl *CompositeListener) protect(fn func()) {
+	cl.listeners[0].protect(fn)
+}
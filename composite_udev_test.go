@@ -0,0 +1,191 @@
+//go:build linux
+
+package hotplug
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// compositeSettle is a settle time short enough for the tests but long
+// enough for a capture's events to be replayed within it.
+const compositeSettle = 100 * time.Millisecond
+
+// recordComposites starts a CompositeListener for hidraw interfaces and
+// returns a channel receiving each Composite as it is reported.
+func recordComposites(t *testing.T, capture *Capture) (*CompositeListener, <-chan *Composite) {
+	t.Helper()
+
+	composites := make(chan *Composite, 10)
+	cl, err := NewCompositeListener([]InterfaceClass{DevIfHid}, compositeSettle,
+		func(c *Composite) { composites <- c }, FromCapture(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cl.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cl.Stop() })
+
+	return cl, composites
+}
+
+// expectComposite waits for a Composite and checks the paths of its
+// interfaces.
+func expectComposite(t *testing.T, composites <-chan *Composite, paths ...string) *Composite {
+	t.Helper()
+
+	select {
+	case c := <-composites:
+		var got []string
+		for _, devIf := range c.Interfaces {
+			got = append(got, devIf.Path)
+		}
+		if strings.Join(got, " ") != strings.Join(paths, " ") {
+			t.Fatalf("got composite of %v, want %v", got, paths)
+		}
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for a composite of %v", paths)
+		return nil
+	}
+}
+
+// expectNoComposite checks that no Composite is reported within a few
+// settle windows.
+func expectNoComposite(t *testing.T, composites <-chan *Composite) {
+	t.Helper()
+
+	select {
+	case c := <-composites:
+		t.Errorf("got unexpected composite of %s", c.Device.Path)
+	case <-time.After(3 * compositeSettle):
+	}
+}
+
+func TestCompositeListener(t *testing.T) {
+	cl, composites := recordComposites(t, loadCapture(t, "hidraw.db", ""))
+
+	c := expectComposite(t, composites, "/dev/hidraw0")
+	if c.Device.Path != "/sys/devices/pci0000:00/0000:00:14.0/usb1/1-2" {
+		t.Errorf("got device %s, want the USB device", c.Device.Path)
+	}
+	if classes := c.Classes(); len(classes) != 1 || classes[0] != DevIfHid {
+		t.Errorf("got classes %v, want only hid", classes)
+	}
+	if c.OnDetach(func() {}) == nil {
+		t.Error("OnDetach succeeded outside the arrive callback")
+	}
+	expectNoComposite(t, composites)
+
+	err := cl.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cause := context.Cause(c.Context()); cause != ErrStopped {
+		t.Errorf("got cause %v, want ErrStopped", cause)
+	}
+}
+
+func TestCompositeRemovedWhileSettling(t *testing.T) {
+	// both receivers are removed before they settle
+	_, composites := recordComposites(t, loadCapture(t, "hidraw.db", "hidraw.events"))
+	expectNoComposite(t, composites)
+}
+
+func TestCompositeGroupsInterfaces(t *testing.T) {
+	// add the second interface of secondInterface but not the removal of
+	// the first
+	capture := loadCapture(t, "hidraw.db", "")
+	events := secondInterface[:strings.Index(secondInterface, "UDEV  [1.3]")]
+	err := capture.ReadMonitor(strings.NewReader(events))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, composites := recordComposites(t, capture)
+	expectComposite(t, composites, "/dev/hidraw0", "/dev/hidraw2")
+	expectNoComposite(t, composites)
+}
+
+func TestCompositeReplacedAfterRemoval(t *testing.T) {
+	// the first interface is removed while the device settles, so only the
+	// second is reported
+	capture := loadCapture(t, "hidraw.db", "")
+	err := capture.ReadMonitor(strings.NewReader(secondInterface))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, composites := recordComposites(t, capture)
+	expectComposite(t, composites, "/dev/hidraw2")
+	expectNoComposite(t, composites)
+}
+
+func TestCompositeDetach(t *testing.T) {
+	detached := make(chan struct{})
+	cl, err := NewCompositeListener([]InterfaceClass{DevIfHid}, compositeSettle,
+		func(c *Composite) {
+			err := c.OnDetach(func() { close(detached) })
+			if err != nil {
+				t.Error(err)
+			}
+		}, FromCapture(loadCapture(t, "hidraw.db", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cl.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Stop()
+
+	// wait for the receiver to be reported, then remove it while the
+	// events are lost
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cl.lock.Lock()
+		group := cl.groups["/sys/devices/pci0000:00/0000:00:14.0/usb1/1-2"]
+		reported := group != nil && group.current != nil
+		cl.lock.Unlock()
+		if reported {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the composite")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	l := cl.listeners[0]
+	src := l.source.(*captureSource)
+	src.lock.Lock()
+	delete(src.devices, testHidraw0)
+	src.lock.Unlock()
+	l.overflow()
+
+	select {
+	case <-detached:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the composite wasn't detached")
+	}
+}
+
+func TestNewCompositeListenerErrors(t *testing.T) {
+	callback := func(c *Composite) {}
+
+	_, err := NewCompositeListener(nil, 0, callback)
+	if err == nil {
+		t.Error("created a listener without classes")
+	}
+
+	_, err = NewCompositeListener([]InterfaceClass{DevIfHid}, -time.Second, callback)
+	if err == nil {
+		t.Error("created a listener with a negative settle time")
+	}
+}
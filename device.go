@@ -1,17 +1,111 @@
 package hotplug
 
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
 import "C"
 
 // A DeviceInterface describes a particular way to interact with a Device.
 type DeviceInterface struct {
-	Path   string
-	Class  InterfaceClass
-	Device *Device
+	Path     string
+	Class    InterfaceClass
+	Device   *Device
+	listener *Listener
+	ctx      context.Context
+
+	// inArrive is set while the arrive callback runs. The callback may run
+	// on a dispatcher's goroutine while OnDetach is called from another, so
+	// it is protected by the Listener's lock.
+	inArrive bool
+
+	// watched is set if the Listener was listening when it reported the
+	// interface, so that its context will be cancelled
+	watched bool
+
 	platformDeviceInterface
 }
 
+// OnDetach registers a callback to be called when the interface is removed.
+// It must be called while the arrive callback is running, usually from the
+// callback itself, though it may be called from any goroutine.
+//
+// On Linux the interface is also considered removed when the USB device or
+// USB interface providing it, or a hub it is plugged into, is removed, so
+// the callback is called exactly once even if the removal event of the
+// interface itself is lost or arrives late.
 func (devIf *DeviceInterface) OnDetach(callback func()) error {
-	return devIf.onDetach(callback)
+	if !devIf.addDetach(callback) {
+		return errors.New("OnDetach must be called from the arrive callback")
+	}
+
+	return nil
+}
+
+// addDetach registers a detach callback if the arrive callback is running,
+// and reports whether it did.
+func (devIf *DeviceInterface) addDetach(callback func()) bool {
+	l := devIf.listener
+	if l == nil {
+		return false
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if !devIf.inArrive {
+		return false
+	}
+
+	key := devIf.key()
+	l.detachCb[key] = append(l.detachCb[key], callback)
+	return true
+}
+
+// Done returns a channel which is closed when the interface is removed or the
+// Listener which reported it is stopped. It may be used from any goroutine.
+//
+// Removal can only be detected while the Listener is listening.
+func (devIf *DeviceInterface) Done() <-chan struct{} {
+	return devIf.Context().Done()
+}
+
+// WatchRemoval arranges for fn to be called once, when the interface is
+// removed or the Listener which reported it is stopped. If called from the
+// arrive callback, fn is called from the detach callback, in order with the
+// Listener's other events, where possible.
+//
+// It returns false, and does nothing, if the removal can't be detected:
+// if the interface wasn't reported by a listening Listener, such as those
+// returned by List, or if it is already gone.
+func (devIf *DeviceInterface) WatchRemoval(fn func()) bool {
+	if devIf.ctx == nil || !devIf.watched || devIf.ctx.Err() != nil {
+		return false
+	}
+
+	var once sync.Once
+	devIf.addDetach(func() { once.Do(fn) })
+
+	// detach callbacks don't run when the Listener is stopped
+	go func() {
+		<-devIf.ctx.Done()
+		once.Do(fn)
+	}()
+
+	return true
+}
+
+// Context returns a context which is cancelled when the interface is removed
+// or the Listener which reported it is stopped. Its cause is ErrRemoved or
+// ErrStopped respectively.
+func (devIf *DeviceInterface) Context() context.Context {
+	if devIf.ctx == nil {
+		return context.Background()
+	}
+
+	return devIf.ctx
 }
 
 type Device struct {
@@ -20,15 +114,127 @@ type Device struct {
 	platformDevice
 }
 
+// ErrNoAncestor is matched by a *NoAncestorError with errors.Is.
+var ErrNoAncestor = errors.New("no matching ancestor found")
+
+// A NoAncestorError is returned when a device has no ancestor of the class,
+// or satisfying the predicate, being looked for.
+type NoAncestorError struct {
+	Path string
+
+	// Class is the class being looked for, or DevUnknown for UpFunc.
+	Class DeviceClass
+}
+
+func (e *NoAncestorError) Error() string {
+	if e.Class == DevUnknown {
+		return "device " + e.Path + " has no matching ancestor"
+	}
+	return "device " + e.Path + " has no " + e.Class.String() + " ancestor"
+}
+
+func (e *NoAncestorError) Is(target error) bool {
+	return target == ErrNoAncestor
+}
+
+// Is reports whether the device is of the given class. A device may be of
+// several classes, such as a USB hub, which is also a USB device, in which
+// case its Class is the most specific of them.
+func (dev *Device) Is(class DeviceClass) bool {
+	return dev.is(class)
+}
+
 func (dev *Device) Parent() (*Device, error) {
 	return dev.parent()
 }
 
+// Ancestors returns the ancestors of the device, starting with its parent
+// and ending with the root of the device tree.
+func (dev *Device) Ancestors() []*Device {
+	var ancestors []*Device
+	for {
+		parent, err := dev.Parent()
+		if err != nil {
+			return ancestors
+		}
+		ancestors = append(ancestors, parent)
+		dev = parent
+	}
+}
+
 // Up finds the nearest ancestor of this device which is of the given class.
 func (dev *Device) Up(class DeviceClass) (*Device, error) {
 	return dev.up(class)
 }
 
+// UpFunc finds the nearest ancestor of this device for which the predicate
+// returns true.
+func (dev *Device) UpFunc(predicate func(ancestor *Device) bool) (*Device, error) {
+	for _, ancestor := range dev.Ancestors() {
+		if predicate(ancestor) {
+			return ancestor, nil
+		}
+	}
+
+	return nil, &NoAncestorError{Path: dev.Path}
+}
+
+// usbDevice returns the device itself if it is a USB device, or else the
+// nearest USB device above it.
+func (dev *Device) usbDevice() (*Device, error) {
+	if dev.Is(DevUsbDevice) {
+		return dev, nil
+	}
+
+	usb, err := dev.Up(DevUsbDevice)
+	if err != nil {
+		return nil, errors.New("device is not provided by a USB device")
+	}
+
+	return usb, nil
+}
+
+// Children returns the devices immediately below this device, sorted by
+// path. It is only supported on Linux.
+func (dev *Device) Children() ([]*Device, error) {
+	return dev.children()
+}
+
+// Descendants returns all of the devices below this device, each followed by
+// its own descendants. It is only supported on Linux.
+func (dev *Device) Descendants() ([]*Device, error) {
+	children, err := dev.Children()
+	if err != nil {
+		return nil, err
+	}
+
+	var descendants []*Device
+	for _, child := range children {
+		descendants = append(descendants, child)
+
+		below, err := child.Descendants()
+		if err != nil {
+			return nil, err
+		}
+		descendants = append(descendants, below...)
+	}
+
+	return descendants, nil
+}
+
+// Interfaces returns the interfaces of the given class which are provided by
+// this device or its descendants, sorted as List sorts them. It is only
+// supported on Linux.
+func (dev *Device) Interfaces(class InterfaceClass) ([]*DeviceInterface, error) {
+	devIfs, err := dev.interfaces(class)
+	if err != nil {
+		return nil, err
+	}
+
+	sortInterfaces(devIfs)
+	return devIfs, nil
+}
+
 // BusNumber is a number distinguishing the bus the device is connected to
 // from other busses of the same type on the computer.
 //
@@ -51,3 +257,38 @@ func (dev *Device) VendorId() (int, error) {
 func (dev *Device) ProductId() (int, error) {
 	return dev.productId()
 }
+
+// SerialNumber is the serial number reported by the device.
+func (dev *Device) SerialNumber() (string, error) {
+	return dev.serialNumber()
+}
+
+// Property returns the value of one of the properties udev records for the
+// device, such as "ID_MODEL". It is only supported on Linux.
+func (dev *Device) Property(key string) (string, error) {
+	return dev.property(key)
+}
+
+// Attribute returns the value of one of the device's sysfs attributes, such
+// as "manufacturer", without its trailing newline. It is only supported on
+// Linux.
+func (dev *Device) Attribute(name string) (string, error) {
+	return dev.attribute(name)
+}
+
+// PortPath identifies the physical port through which the device is
+// connected, which unlike Address doesn't change when it is reconnected.
+//
+// On Linux it is only available for USB devices and is the chain of hub port
+// numbers from the root hub, such as "1-2.3" for port 3 of the hub on port 2
+// of bus 1. On Windows it is the device's location path.
+func (dev *Device) PortPath() (string, error) {
+	return dev.portPath()
+}
+
+// InterfaceNumber returns the number of the USB interface which provides the
+// device, or which is the device, distinguishing the functions of a
+// composite USB device.
+func (dev *Device) InterfaceNumber() (int, error) {
+	return dev.interfaceNumber()
+}
@@ -4,71 +4,57 @@ package hotplug
 
 import (
 	"errors"
-	"runtime"
+	"path"
+	"strconv"
+	"strings"
 )
 
-/*
-	#cgo pkg-config: libudev
-	#include <libudev.h>
-	#include <stdlib.h>
-*/
-import "C"
-
 type platformDeviceInterface struct {
-	listener *Listener
-	devpath  string
-	inArrive bool
-}
+	devpath string
 
-func (devIf *DeviceInterface) onDetach(callback func()) error {
-	if !devIf.inArrive {
-		return errors.New("OnDetach must be called from the arrive callback")
-	}
+	// sys is the interface's own node, which for some classes is a child
+	// of the Device
+	sys sysDevice
+}
 
-	callbacks := devIf.listener.detachCb[devIf.devpath]
-	if callbacks == nil {
-		callbacks = make([]func(), 1)
-	}
+func (devIf *DeviceInterface) key() string {
+	return devIf.devpath
+}
 
-	devIf.listener.detachCb[devIf.devpath] = append(callbacks, callback)
-	return nil
+func (devIf *DeviceInterface) node() *Device {
+	return newDevice(devIf.Device.listener, devIf.sys)
 }
 
 type platformDevice struct {
 	// prevents the udev context from being freed before the device
 	listener *Listener
-	udev     *C.struct_udev_device
+	sys      sysDevice
 }
 
-func newDevice(listener *Listener, udev *C.struct_udev_device) *Device {
-	syspath := C.udev_device_get_syspath(udev)
+// devpath returns the path of the device in sysfs without the /sys prefix.
+func (dev *Device) devpath() string {
+	return dev.sys.devpath()
+}
 
+func newDevice(listener *Listener, sys sysDevice) *Device {
 	var class DeviceClass
-	for maybeClass, cond := range deviceClassCondition {
-		if cond.matches(udev) {
+	for _, maybeClass := range deviceClassOrder {
+		if deviceClassCondition[maybeClass].matches(sys) {
 			class = maybeClass
 			break
 		}
 	}
 
 	dev := &Device{}
-	dev.Path = C.GoString(syspath)
+	dev.Path = sys.syspath()
 	dev.Class = class
 	dev.listener = listener
-	dev.udev = udev
-
-	C.udev_device_ref(udev)
-	runtime.SetFinalizer(dev, freeDevice)
+	dev.sys = sys
 	return dev
 }
 
-func freeDevice(dev *Device) {
-	C.udev_device_unref(dev.udev)
-	dev.udev = nil
-}
-
 func (dev *Device) parent() (*Device, error) {
-	parent := C.udev_device_get_parent(dev.udev)
+	parent := dev.sys.parent()
 	if parent == nil {
 		return nil, errors.New("no parent")
 	}
@@ -76,14 +62,22 @@ func (dev *Device) parent() (*Device, error) {
 	return newDevice(dev.listener, parent), nil
 }
 
+func (dev *Device) is(class DeviceClass) bool {
+	cond := deviceClassCondition[class]
+	return cond != nil && cond.matches(dev.sys)
+}
+
 func (dev *Device) up(class DeviceClass) (*Device, error) {
 	cond := deviceClassCondition[class]
+	if cond == nil {
+		return nil, errors.New("unsupported DeviceClass")
+	}
 
-	parent := dev.udev
+	parent := dev.sys
 	for {
-		parent = C.udev_device_get_parent(parent)
+		parent = parent.parent()
 		if parent == nil {
-			return nil, errors.New("no matching ancestor found")
+			return nil, &NoAncestorError{Path: dev.Path, Class: class}
 		}
 
 		if cond.matches(parent) {
@@ -92,36 +86,150 @@ func (dev *Device) up(class DeviceClass) (*Device, error) {
 	}
 }
 
-func (dev *Device) getSysAttrLong(attr *C.char, base int) (int, error) {
-	val := C.udev_device_get_sysattr_value(dev.udev, attr)
-	if val == nil {
+func (dev *Device) children() ([]*Device, error) {
+	sysChildren, err := dev.listener.source.children(dev.sys.syspath())
+	if err != nil {
+		return nil, err
+	}
+
+	children := make([]*Device, len(sysChildren))
+	for i, child := range sysChildren {
+		children[i] = newDevice(dev.listener, child)
+	}
+
+	sortDevices(children)
+	return children, nil
+}
+
+func (dev *Device) interfaces(class InterfaceClass) ([]*DeviceInterface, error) {
+	cond := interfaceClassCondition[class]
+	if cond == nil {
+		return nil, errors.New("unsupported InterfaceClass")
+	}
+
+	// newInterface only needs the class, condition and source of a Listener
+	l := &Listener{class: class}
+	l.condition = cond
+	l.source = dev.listener.source
+
+	devices, err := l.source.enumerate(cond)
+	if err != nil {
+		return nil, err
+	}
+
+	var devIfs []*DeviceInterface
+	prefix := dev.sys.syspath() + "/"
+	for _, sys := range devices {
+		if !strings.HasPrefix(sys.syspath(), prefix) {
+			continue
+		}
+
+		devIf := l.newInterface(sys)
+		if devIf != nil {
+			devIfs = append(devIfs, devIf)
+		}
+	}
+
+	return devIfs, nil
+}
+
+func (dev *Device) getSysAttrLong(attr string, base int) (int, error) {
+	val, ok := dev.sys.sysattr(attr)
+	if !ok {
 		return 0, errors.New("attribute not found")
 	}
 
-	return (int)(C.strtol(val, nil, (C.int)(base))), nil
+	result, err := strconv.ParseInt(strings.TrimSpace(val), base, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	return (int)(result), nil
+}
+
+func (dev *Device) property(key string) (string, error) {
+	val, ok := dev.sys.property(key)
+	if !ok {
+		return "", errors.New("property not found")
+	}
+
+	return val, nil
+}
+
+func (dev *Device) attribute(name string) (string, error) {
+	val, ok := dev.sys.sysattr(name)
+	if !ok {
+		return "", errors.New("attribute not found")
+	}
+
+	return strings.TrimRight(val, "\n"), nil
 }
 
 func (dev *Device) path() (string, error) {
-	path := C.udev_device_get_devpath(dev.udev)
-	if path == nil {
+	path := dev.sys.devpath()
+	if path == "" {
 		return "", errors.New("failed to get devpath")
 	}
 
-	return C.GoString(path), nil
+	return path, nil
 }
 
 func (dev *Device) busNumber() (int, error) {
-	return dev.getSysAttrLong(C.CString("busnum"), 10)
+	return dev.getSysAttrLong("busnum", 10)
 }
 
 func (dev *Device) address() (int, error) {
-	return dev.getSysAttrLong(C.CString("devnum"), 10)
+	return dev.getSysAttrLong("devnum", 10)
 }
 
 func (dev *Device) vendorId() (int, error) {
-	return dev.getSysAttrLong(C.CString("idVendor"), 16)
+	return dev.getSysAttrLong("idVendor", 16)
 }
 
 func (dev *Device) productId() (int, error) {
-	return dev.getSysAttrLong(C.CString("idProduct"), 16)
+	return dev.getSysAttrLong("idProduct", 16)
+}
+
+func (dev *Device) serialNumber() (string, error) {
+	serial, ok := dev.sys.sysattr("serial")
+	if !ok {
+		return "", errors.New("attribute not found")
+	}
+
+	return strings.TrimSpace(serial), nil
+}
+
+func (dev *Device) portPath() (string, error) {
+	if dev.sys.subsystem() != "usb" || dev.sys.devtype() != "usb_device" {
+		return "", errors.New("port path is only available for USB devices")
+	}
+
+	// the kernel names USB devices after the port they're connected to
+	return path.Base(dev.sys.devpath()), nil
+}
+
+func (dev *Device) interfaceNumber() (int, error) {
+	usbIf := dev
+	if !dev.Is(DevUsbInterface) {
+		var err error
+		usbIf, err = dev.Up(DevUsbInterface)
+		if err != nil {
+			return 0, errors.New("device is not provided by a USB interface")
+		}
+	}
+
+	// the kernel names USB interfaces after the device's port path and the
+	// configuration and interface numbers, such as 1-2.3:1.0
+	_, config, _ := strings.Cut(path.Base(usbIf.sys.devpath()), ":")
+	_, number, ok := strings.Cut(config, ".")
+	if !ok {
+		return 0, errors.New("unexpected USB interface name")
+	}
+
+	result, err := strconv.Atoi(number)
+	if err != nil {
+		return 0, err
+	}
+
+	return result, nil
 }
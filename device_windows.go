@@ -8,6 +8,7 @@ import (
 	"golang.org/x/sys/windows"
 	"regexp"
 	"strconv"
+	"strings"
 )
 
 // #include "common_windows.h"
@@ -16,22 +17,14 @@ import "C"
 type platformDeviceInterface struct {
 	symbolicLink []uint16
 	classGuid    C.GUID
-	inArrive     bool
-	listener     *Listener
 }
 
-func (devIf *DeviceInterface) onDetach(callback func()) error {
-	if !devIf.inArrive {
-		return errors.New("OnDetach must be called from the arrive callback")
-	}
-
-	callbacks := devIf.listener.detachCb[devIf.Path]
-	if callbacks == nil {
-		callbacks = make([]func(), 1)
-	}
+func (devIf *DeviceInterface) key() string {
+	return devIf.Path
+}
 
-	devIf.listener.detachCb[devIf.Path] = append(callbacks, callback)
-	return nil
+func (devIf *DeviceInterface) node() *Device {
+	return devIf.Device
 }
 
 type platformDevice struct {
@@ -42,10 +35,27 @@ type platformDevice struct {
 	cacheSerial    string
 }
 
+// devpath stands in for the sysfs path of a device on Linux.
+func (dev *Device) devpath() string {
+	return dev.Path
+}
+
 func (dev *Device) parent() (*Device, error) {
 	return nil, errors.New("not implemented")
 }
 
+func (dev *Device) is(class DeviceClass) bool {
+	return dev.Class == class
+}
+
+func (dev *Device) children() ([]*Device, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (dev *Device) interfaces(class InterfaceClass) ([]*DeviceInterface, error) {
+	return nil, errors.New("not implemented")
+}
+
 func (dev *Device) up(class DeviceClass) (*Device, error) {
 	devInst := dev.deviceInstance
 	targetClassGuid, haveClassGuid := deviceClassToGuid[class]
@@ -56,7 +66,10 @@ func (dev *Device) up(class DeviceClass) (*Device, error) {
 	for {
 		var parentInst C.DEVINST
 		sta := C.CM_Get_Parent(&parentInst, devInst, 0)
-		if sta != C.CR_SUCCESS {
+		if sta == C.CR_NO_SUCH_DEVNODE {
+			// we've passed the root of the device tree
+			return nil, &NoAncestorError{Path: dev.Path, Class: class}
+		} else if sta != C.CR_SUCCESS {
 			return nil, errors.New(fmt.Sprintf(
 				"failed to get parent device (CONFIGRET 0x%X)",
 				sta,
@@ -64,6 +77,8 @@ func (dev *Device) up(class DeviceClass) (*Device, error) {
 		}
 		devInst = parentInst
 
+		// the root of the device tree has no class, so a failure here
+		// just means the device doesn't match
 		var classGuid C.GUID
 		err := getDevPropFixed(
 			devInst,
@@ -71,11 +86,7 @@ func (dev *Device) up(class DeviceClass) (*Device, error) {
 			C.DEVPROP_TYPE_GUID,
 			&classGuid,
 		)
-		if err != nil {
-			return nil, err
-		}
-
-		if classGuid == targetClassGuid {
+		if err == nil && classGuid == targetClassGuid {
 			break
 		}
 	}
@@ -100,6 +111,14 @@ func (dev *Device) up(class DeviceClass) (*Device, error) {
 	return parent, nil
 }
 
+func (dev *Device) property(key string) (string, error) {
+	return "", errors.New("device properties are not supported on Windows")
+}
+
+func (dev *Device) attribute(name string) (string, error) {
+	return "", errors.New("device attributes are not supported on Windows")
+}
+
 func (dev *Device) busNumber() (int, error) {
 	var result uint32
 	err := getDevPropFixed(
@@ -173,3 +192,56 @@ func (dev *Device) productId() (int, error) {
 		return 0, errors.New("property not supported for this DeviceClass")
 	}
 }
+
+func (dev *Device) serialNumber() (string, error) {
+	if dev.Class != DevUsbDevice {
+		return "", errors.New("property not supported for this DeviceClass")
+	}
+
+	if dev.cacheSerial == "" {
+		err := dev.parseUsbPath()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// devices without a serial number get a generated instance ID instead,
+	// which always contains an ampersand
+	if strings.Contains(dev.cacheSerial, "&") {
+		return "", errors.New("device has no serial number")
+	}
+
+	return dev.cacheSerial, nil
+}
+
+// the instance IDs of the functions of composite devices include the
+// interface number, such as USB\VID_046D&PID_C52B&MI_01\...
+var reInterfaceNumber = regexp.MustCompile(`&MI_([0-9A-F]{2})`)
+
+func (dev *Device) interfaceNumber() (int, error) {
+	match := reInterfaceNumber.FindStringSubmatch(strings.ToUpper(dev.Path))
+	if match == nil {
+		return 0, errors.New("device is not provided by a USB interface")
+	}
+
+	result, err := strconv.ParseInt(match[1], 16, 32)
+	return (int)(result), err
+}
+
+func (dev *Device) portPath() (string, error) {
+	paths, err := getDevPropSlice[uint16](
+		dev.deviceInstance,
+		&C.DEVPKEY_Device_LocationPaths,
+		C.DEVPROP_TYPE_STRING_LIST,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	list := splitUTF16StringList(paths)
+	if len(list) == 0 {
+		return "", errors.New("device has no location path")
+	}
+
+	return windows.UTF16ToString(list[0]), nil
+}
@@ -0,0 +1,182 @@
+package hotplug
+
+import (
+	"errors"
+	"sync"
+)
+
+// dispatcher decides which goroutine runs the callbacks for each event.
+//
+// Callbacks submitted with the same key are always run in the order they
+// were submitted and never concurrently with each other.
+type dispatcher interface {
+	submit(key string, fn func())
+
+	// wait blocks until all submitted callbacks have finished.
+	wait()
+}
+
+// DispatchSerial makes the Listener run callbacks one at a time on the
+// goroutine which received the event. This is the default.
+//
+// A slow callback holds up the delivery of every other event.
+func DispatchSerial() Option {
+	return func(l *Listener) error {
+		l.dispatcher = serialDispatcher{}
+		return nil
+	}
+}
+
+// DispatchPerDevice makes the Listener run the callbacks for each device
+// interface on a goroutine of its own. Events for the same interface are
+// still delivered in order.
+func DispatchPerDevice() Option {
+	return func(l *Listener) error {
+		l.dispatcher = newQueueDispatcher()
+		return nil
+	}
+}
+
+// DispatchPool makes the Listener run callbacks on at most the given number
+// of goroutines, however many events are waiting. Events for the same
+// interface are still delivered in order.
+func DispatchPool(workers int) Option {
+	return func(l *Listener) error {
+		if workers < 1 {
+			return errors.New("worker pool must have at least one worker")
+		}
+
+		l.dispatcher = newPoolDispatcher(workers)
+		return nil
+	}
+}
+
+// serialDispatcher runs callbacks immediately.
+type serialDispatcher struct{}
+
+func (serialDispatcher) submit(key string, fn func()) {
+	fn()
+}
+
+func (serialDispatcher) wait() {}
+
+// queueDispatcher keeps a queue of callbacks for each key, which is drained
+// by a goroutine that exists while the queue is not empty.
+type queueDispatcher struct {
+	lock    sync.Mutex
+	queues  map[string][]func()
+	running sync.WaitGroup
+}
+
+func newQueueDispatcher() *queueDispatcher {
+	return &queueDispatcher{queues: make(map[string][]func())}
+}
+
+func (d *queueDispatcher) submit(key string, fn func()) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	queue, draining := d.queues[key]
+	d.queues[key] = append(queue, fn)
+
+	if !draining {
+		d.running.Add(1)
+		go d.drain(key)
+	}
+}
+
+func (d *queueDispatcher) drain(key string) {
+	defer d.running.Done()
+
+	for {
+		d.lock.Lock()
+		queue := d.queues[key]
+		if len(queue) == 0 {
+			delete(d.queues, key)
+			d.lock.Unlock()
+			return
+		}
+		fn := queue[0]
+		d.queues[key] = queue[1:]
+		d.lock.Unlock()
+
+		fn()
+	}
+}
+
+func (d *queueDispatcher) wait() {
+	d.running.Wait()
+}
+
+// poolDispatcher keeps a queue of callbacks for each key and a queue of the
+// keys with callbacks waiting, from which a limited number of workers take
+// keys in turn. A worker runs one callback for a key and then puts the key
+// back at the end of the queue if it has more, so that one busy interface
+// doesn't hold up the others. Workers exit when there is nothing to do.
+type poolDispatcher struct {
+	lock    sync.Mutex
+	limit   int
+	workers int
+
+	// queues has an entry for each key which has callbacks waiting or
+	// running, and ready holds those which have callbacks waiting and none
+	// running
+	queues map[string][]func()
+	ready  []string
+
+	running sync.WaitGroup
+}
+
+func newPoolDispatcher(limit int) *poolDispatcher {
+	return &poolDispatcher{
+		limit:  limit,
+		queues: make(map[string][]func()),
+	}
+}
+
+func (d *poolDispatcher) submit(key string, fn func()) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	queue, known := d.queues[key]
+	d.queues[key] = append(queue, fn)
+	if known {
+		// the key is already waiting, or its worker will requeue it
+		return
+	}
+
+	d.ready = append(d.ready, key)
+	if d.workers < d.limit {
+		d.workers++
+		d.running.Add(1)
+		go d.work()
+	}
+}
+
+func (d *poolDispatcher) work() {
+	defer d.running.Done()
+
+	d.lock.Lock()
+	for len(d.ready) > 0 {
+		key := d.ready[0]
+		d.ready = d.ready[1:]
+		fn := d.queues[key][0]
+		d.queues[key] = d.queues[key][1:]
+		d.lock.Unlock()
+
+		fn()
+
+		d.lock.Lock()
+		if len(d.queues[key]) == 0 {
+			delete(d.queues, key)
+		} else {
+			d.ready = append(d.ready, key)
+		}
+	}
+	d.workers--
+	d.lock.Unlock()
+}
+
+func (d *poolDispatcher) wait() {
+	d.running.Wait()
+}
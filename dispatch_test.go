@@ -0,0 +1,97 @@
+package hotplug
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// runDispatcher submits callbacks for several keys and checks that the
+// callbacks for each key run in order and one at a time. It returns the
+// largest number of callbacks which ran at once.
+func runDispatcher(t *testing.T, d dispatcher) int {
+	t.Helper()
+
+	const keys = 8
+	const perKey = 20
+
+	var lock sync.Mutex
+	running, maxRunning := 0, 0
+	busy := make(map[string]bool)
+	next := make(map[string]int)
+
+	for i := 0; i < perKey; i++ {
+		for k := 0; k < keys; k++ {
+			key := "key" + strconv.Itoa(k)
+			seq := i
+			d.submit(key, func() {
+				lock.Lock()
+				if busy[key] {
+					t.Errorf("callbacks for %s ran concurrently", key)
+				}
+				if next[key] != seq {
+					t.Errorf("callback %d for %s ran when %d was expected", seq, key, next[key])
+				}
+				busy[key] = true
+				next[key] = seq + 1
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				lock.Unlock()
+
+				time.Sleep(time.Millisecond)
+
+				lock.Lock()
+				busy[key] = false
+				running--
+				lock.Unlock()
+			})
+		}
+	}
+
+	d.wait()
+
+	for k := 0; k < keys; k++ {
+		key := "key" + strconv.Itoa(k)
+		if next[key] != perKey {
+			t.Errorf("ran %d callbacks for %s, want %d", next[key], key, perKey)
+		}
+	}
+
+	return maxRunning
+}
+
+func TestSerialDispatcher(t *testing.T) {
+	if n := runDispatcher(t, serialDispatcher{}); n != 1 {
+		t.Errorf("ran %d callbacks at once, want 1", n)
+	}
+}
+
+func TestQueueDispatcher(t *testing.T) {
+	if n := runDispatcher(t, newQueueDispatcher()); n < 2 {
+		t.Errorf("ran at most %d callbacks at once, want callbacks for different keys to overlap", n)
+	}
+}
+
+func TestPoolDispatcher(t *testing.T) {
+	d := newPoolDispatcher(3)
+	if n := runDispatcher(t, d); n > 3 || n < 2 {
+		t.Errorf("ran at most %d callbacks at once, want 2 or 3", n)
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.workers != 0 || len(d.queues) != 0 || len(d.ready) != 0 {
+		t.Errorf("pool didn't clean up: %d workers, %d queues, %d ready",
+			d.workers, len(d.queues), len(d.ready))
+	}
+}
+
+func TestDispatchPoolRejectsNoWorkers(t *testing.T) {
+	err := DispatchPool(0)(&Listener{})
+	if err == nil {
+		t.Error("DispatchPool(0) succeeded")
+	}
+}
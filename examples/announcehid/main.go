@@ -55,14 +55,9 @@ func main() {
 		},
 	)
 
-	err := listener.Listen()
+	err := listener.Start()
 	if err != nil {
-		fmt.Printf("failed to listen: %s\n", err.Error())
-	}
-
-	err = listener.Enumerate()
-	if err != nil {
-		fmt.Printf("failed to enumerate: %s\n", err.Error())
+		fmt.Printf("failed to start: %s\n", err.Error())
 	}
 
 	// sleep forever and handle events
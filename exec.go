@@ -0,0 +1,288 @@
+package hotplug
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// ExecConfig configures an Executor.
+type ExecConfig struct {
+	// Arrive is the command line run when an interface arrives, or nil to
+	// run nothing. The first element is the program, which is looked up in
+	// the PATH if it contains no path separators.
+	Arrive []string
+
+	// Remove is the command line run when an interface is removed, or nil
+	// to run nothing.
+	Remove []string
+
+	// Filter selects the interfaces to run commands for.
+	Filter Filter
+
+	// Dir is the working directory of the commands. If empty they run in
+	// the current directory.
+	Dir string
+
+	// Env holds extra environment variables for the commands, in the form
+	// "key=value". They are added to this process's environment and the
+	// variables describing the event.
+	Env []string
+
+	// Timeout limits how long each command may run before it is killed.
+	// Zero means no limit.
+	Timeout time.Duration
+
+	// MaxConcurrent limits how many commands run at once. Zero means no
+	// limit.
+	MaxConcurrent int
+
+	// Result, if not nil, is called with the outcome of each command once
+	// it exits. It may be called from several goroutines at once.
+	Result func(result *ExecResult)
+}
+
+// An ExecResult is the outcome of a command run by an Executor.
+type ExecResult struct {
+	Event   Event
+	Command []string
+
+	// Output holds what the command wrote to its standard output and
+	// standard error, interleaved. Only the last MaxExecOutput bytes are
+	// kept, so a command which writes a lot doesn't use up memory.
+	Output []byte
+
+	// Err is nil if the command exited successfully. Otherwise it is
+	// usually an *exec.ExitError, or ErrExecTimeout if the command was
+	// killed for running too long.
+	Err error
+
+	Duration time.Duration
+}
+
+// MaxExecOutput is how much of the output of a command is kept in its
+// ExecResult.
+const MaxExecOutput = 64 * 1024
+
+// ErrExecTimeout is the error of an ExecResult for a command which was
+// killed because it ran longer than the configured Timeout.
+var ErrExecTimeout = errors.New("command timed out")
+
+// An Executor runs commands as device interfaces arrive and are removed,
+// passing the details of the interface in environment variables:
+//
+//	HOTPLUG_ACTION        "arrive" or "remove"
+//	HOTPLUG_CLASS         the interface class, e.g. "hid"
+//	HOTPLUG_PATH          the interface path, which is the device node on
+//	                      Linux, e.g. "/dev/hidraw0"
+//	HOTPLUG_DEVICE_PATH   the path of the device providing the interface
+//	HOTPLUG_DEVICE_CLASS  the class of that device
+//	HOTPLUG_VENDOR_ID     the USB vendor ID, as four hexadecimal digits
+//	HOTPLUG_PRODUCT_ID    the USB product ID, as four hexadecimal digits
+//	HOTPLUG_VENDOR_NAME   the name of the USB vendor, from the ID database
+//	HOTPLUG_PRODUCT_NAME  the name of the USB product, from the ID database
+//	HOTPLUG_SERIAL        the USB serial number
+//	HOTPLUG_PORT_PATH     the USB port path
+//	HOTPLUG_STABLE_ID     the stable ID of the USB device
+//	HOTPLUG_BUS_NUMBER    the USB bus number
+//	HOTPLUG_ADDRESS       the USB device address
+//	HOTPLUG_PORT_LABEL    the label of the USB port, as set with SetPortLabels
+//
+// The USB variables are only set if the interface is provided by a USB
+// device and the detail is known.
+//
+// Pass the Executor's Add method to New as the callback, or call it from
+// the callback. Commands run in the background so that they don't hold up
+// the Listener, but the removal command for an interface doesn't start
+// until its arrival command has exited.
+type Executor struct {
+	config    ExecConfig
+	semaphore chan struct{}
+	running   sync.WaitGroup
+}
+
+func NewExecutor(config ExecConfig) (*Executor, error) {
+	if config.Arrive != nil && len(config.Arrive) == 0 ||
+		config.Remove != nil && len(config.Remove) == 0 {
+		return nil, errors.New("command line must not be empty")
+	}
+
+	if config.MaxConcurrent < 0 {
+		return nil, errors.New("concurrency limit must not be negative")
+	}
+
+	exe := &Executor{config: config}
+	if config.MaxConcurrent > 0 {
+		exe.semaphore = make(chan struct{}, config.MaxConcurrent)
+	}
+
+	return exe, nil
+}
+
+// Add runs the arrival command for an interface and arranges for the
+// removal command to run when it is removed. It has the signature of a
+// ListenerCallback so that it can be passed to New.
+func (exe *Executor) Add(devIf *DeviceInterface) {
+	if !exe.config.Filter.Matches(devIf) {
+		return
+	}
+
+	// the details can't be looked up once the device has gone, so collect
+	// them now for the removal as well
+	info := devIf.Info()
+
+	arrived := make(chan struct{})
+	if exe.config.Arrive != nil {
+		exe.start(exe.config.Arrive, ActionArrive, info, nil, arrived)
+	} else {
+		close(arrived)
+	}
+
+	if exe.config.Remove != nil {
+		devIf.OnDetach(func() {
+			exe.start(exe.config.Remove, ActionRemove, info, arrived, nil)
+		})
+	}
+}
+
+// Wait blocks until all of the commands which have been started exit.
+func (exe *Executor) Wait() {
+	exe.running.Wait()
+}
+
+// start runs a command in the background once the after channel, if any,
+// is closed. It closes the done channel, if any, once the command exits.
+func (exe *Executor) start(
+	command []string,
+	action string,
+	info InterfaceInfo,
+	after <-chan struct{},
+	done chan<- struct{},
+) {
+	evt := Event{Action: action, Time: time.Now(), Interface: info}
+
+	exe.running.Add(1)
+	go func() {
+		defer exe.running.Done()
+		if done != nil {
+			defer close(done)
+		}
+
+		if after != nil {
+			<-after
+		}
+
+		if exe.semaphore != nil {
+			exe.semaphore <- struct{}{}
+			defer func() { <-exe.semaphore }()
+		}
+
+		result := exe.run(command, evt)
+		if exe.config.Result != nil {
+			exe.config.Result(result)
+		}
+	}()
+}
+
+func (exe *Executor) run(command []string, evt Event) *ExecResult {
+	ctx := context.Background()
+	if exe.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, exe.config.Timeout)
+		defer cancel()
+	}
+
+	var output tailBuffer
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Dir = exe.config.Dir
+	cmd.Env = append(append(os.Environ(), execEnv(evt)...), exe.config.Env...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	// don't wait forever for the output of any background processes the
+	// command left behind after it was killed
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		err = ErrExecTimeout
+	}
+
+	return &ExecResult{
+		Event:    evt,
+		Command:  command,
+		Output:   output.data,
+		Err:      err,
+		Duration: time.Since(start),
+	}
+}
+
+// tailBuffer is a writer which keeps the last MaxExecOutput bytes written
+// to it.
+type tailBuffer struct {
+	data []byte
+}
+
+func (buf *tailBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(p) >= MaxExecOutput {
+		buf.data = append(buf.data[:0], p[len(p)-MaxExecOutput:]...)
+		return n, nil
+	}
+
+	if extra := len(buf.data) + len(p) - MaxExecOutput; extra > 0 {
+		buf.data = append(buf.data[:0], buf.data[extra:]...)
+	}
+	buf.data = append(buf.data, p...)
+	return n, nil
+}
+
+// execEnv lists the environment variables which describe an event.
+func execEnv(evt Event) []string {
+	info := evt.Interface
+	env := []string{
+		"HOTPLUG_ACTION=" + evt.Action,
+		"HOTPLUG_CLASS=" + info.Class,
+		"HOTPLUG_PATH=" + info.Path,
+		"HOTPLUG_DEVICE_PATH=" + info.DevicePath,
+		"HOTPLUG_DEVICE_CLASS=" + info.DeviceClass,
+	}
+
+	if info.VendorId != 0 || info.ProductId != 0 {
+		env = append(env,
+			fmt.Sprintf("HOTPLUG_VENDOR_ID=%04x", info.VendorId),
+			fmt.Sprintf("HOTPLUG_PRODUCT_ID=%04x", info.ProductId),
+		)
+	}
+	if info.VendorName != "" {
+		env = append(env, "HOTPLUG_VENDOR_NAME="+info.VendorName)
+	}
+	if info.ProductName != "" {
+		env = append(env, "HOTPLUG_PRODUCT_NAME="+info.ProductName)
+	}
+	if info.SerialNumber != "" {
+		env = append(env, "HOTPLUG_SERIAL="+info.SerialNumber)
+	}
+	if info.PortPath != "" {
+		env = append(env, "HOTPLUG_PORT_PATH="+info.PortPath)
+	}
+	if info.StableID != "" {
+		env = append(env, "HOTPLUG_STABLE_ID="+info.StableID)
+	}
+	if info.BusNumber != 0 {
+		env = append(env, fmt.Sprintf("HOTPLUG_BUS_NUMBER=%d", info.BusNumber))
+	}
+	if info.Address != 0 {
+		env = append(env, fmt.Sprintf("HOTPLUG_ADDRESS=%d", info.Address))
+	}
+	if info.PortLabel != "" {
+		env = append(env, "HOTPLUG_PORT_LABEL="+info.PortLabel)
+	}
+
+	return env
+}
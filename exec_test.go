@@ -0,0 +1,43 @@
+package hotplug
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTailBuffer(t *testing.T) {
+	var buf tailBuffer
+	buf.Write([]byte("hello "))
+	buf.Write([]byte("world"))
+	if string(buf.data) != "hello world" {
+		t.Errorf("got %q, want everything written", buf.data)
+	}
+
+	buf.Write(bytes.Repeat([]byte("a"), MaxExecOutput-5))
+	if len(buf.data) != MaxExecOutput || !bytes.HasPrefix(buf.data, []byte("world")) {
+		t.Errorf("got %d bytes starting %q, want the last MaxExecOutput",
+			len(buf.data), buf.data[:5])
+	}
+
+	n, _ := buf.Write(bytes.Repeat([]byte("b"), MaxExecOutput+10))
+	if n != MaxExecOutput+10 {
+		t.Errorf("got %d written, want all of it", n)
+	}
+	if len(buf.data) != MaxExecOutput || buf.data[0] != 'b' {
+		t.Errorf("got %d bytes starting %q, want only the last write",
+			len(buf.data), buf.data[:1])
+	}
+}
+
+func TestNewExecutorErrors(t *testing.T) {
+	for _, config := range []ExecConfig{
+		{Arrive: []string{}},
+		{Remove: []string{}},
+		{Arrive: []string{"true"}, MaxConcurrent: -1},
+	} {
+		_, err := NewExecutor(config)
+		if err == nil {
+			t.Errorf("got no error for %+v", config)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+//go:build linux
+
+package hotplug
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecutor(t *testing.T) {
+	results := make(chan *ExecResult, 10)
+	exe, err := NewExecutor(ExecConfig{
+		Arrive: []string{"sh", "-c", "sleep 0.1; echo $HOTPLUG_ACTION $HOTPLUG_PATH"},
+		Remove: []string{"sh", "-c", "echo $HOTPLUG_ACTION $HOTPLUG_PATH $HOTPLUG_SERIAL"},
+		Filter: MatchPortPath("1-2"),
+		Result: func(result *ExecResult) { results <- result },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := New(DevIfHid, exe.Add,
+		FromCapture(loadCapture(t, "hidraw.db", "hidraw.events")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = l.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Stop()
+
+	// hidraw1 is on port 1-3, so only hidraw0 runs commands, and its
+	// removal waits for the slow arrival command
+	for _, want := range []string{
+		"arrive /dev/hidraw0\n",
+		"remove /dev/hidraw0 ABC123\n",
+	} {
+		select {
+		case result := <-results:
+			if string(result.Output) != want || result.Err != nil {
+				t.Errorf("got %q, %v, want %q", result.Output, result.Err, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+
+	exe.Wait()
+	select {
+	case result := <-results:
+		t.Errorf("got unexpected %q", result.Output)
+	default:
+	}
+}
+
+func TestExecRun(t *testing.T) {
+	exe, err := NewExecutor(ExecConfig{
+		Env:     []string{"EXTRA=yes"},
+		Timeout: time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evt := Event{
+		Action: ActionArrive,
+		Interface: InterfaceInfo{
+			Class:     "hid",
+			Path:      "/dev/hidraw0",
+			VendorId:  0x46d,
+			ProductId: 0xc52b,
+			BusNumber: 1,
+		},
+	}
+	result := exe.run([]string{"sh", "-c",
+		"echo $HOTPLUG_ACTION $HOTPLUG_PATH $HOTPLUG_VENDOR_ID:$HOTPLUG_PRODUCT_ID" +
+			" $HOTPLUG_BUS_NUMBER $EXTRA $HOTPLUG_SERIAL; echo oops >&2; exit 3"}, evt)
+
+	want := "arrive /dev/hidraw0 046d:c52b 1 yes\noops\n"
+	if string(result.Output) != want {
+		t.Errorf("got output %q, want %q", result.Output, want)
+	}
+	if result.Err == nil || !strings.Contains(result.Err.Error(), "exit status 3") {
+		t.Errorf("got error %v, want exit status 3", result.Err)
+	}
+}
+
+func TestExecTimeout(t *testing.T) {
+	exe, err := NewExecutor(ExecConfig{Timeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := exe.run([]string{"sleep", "10"}, Event{Action: ActionArrive})
+	if result.Err != ErrExecTimeout {
+		t.Errorf("got error %v, want ErrExecTimeout", result.Err)
+	}
+	if result.Duration > 5*time.Second {
+		t.Errorf("took %v, want the command killed", result.Duration)
+	}
+}
@@ -0,0 +1,102 @@
+package hotplug
+
+// A Filter selects device interfaces. A nil Filter selects all interfaces.
+type Filter func(devIf *DeviceInterface) bool
+
+// Matches reports whether the Filter selects the interface.
+func (filter Filter) Matches(devIf *DeviceInterface) bool {
+	return filter == nil || filter(devIf)
+}
+
+// MatchAll selects the interfaces which all of the filters select.
+func MatchAll(filters ...Filter) Filter {
+	return func(devIf *DeviceInterface) bool {
+		for _, filter := range filters {
+			if !filter.Matches(devIf) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// MatchVendorProduct selects the interfaces of USB devices with the given
+// vendor and product IDs. A negative product ID matches any product.
+func MatchVendorProduct(vendorId int, productId int) Filter {
+	return func(devIf *DeviceInterface) bool {
+		usb, err := devIf.Device.usbDevice()
+		if err != nil {
+			return false
+		}
+
+		actualVendorId, err := usb.VendorId()
+		if err != nil || actualVendorId != vendorId {
+			return false
+		}
+
+		if productId < 0 {
+			return true
+		}
+
+		actualProductId, err := usb.ProductId()
+		return err == nil && actualProductId == productId
+	}
+}
+
+// MatchSerial selects the interfaces of USB devices with the given serial
+// number.
+func MatchSerial(serial string) Filter {
+	return func(devIf *DeviceInterface) bool {
+		usb, err := devIf.Device.usbDevice()
+		if err != nil {
+			return false
+		}
+
+		actual, err := usb.SerialNumber()
+		return err == nil && actual == serial
+	}
+}
+
+// MatchPortPath selects the interfaces of USB devices connected through the
+// port with the given path, as returned by Device.PortPath.
+func MatchPortPath(portPath string) Filter {
+	return func(devIf *DeviceInterface) bool {
+		usb, err := devIf.Device.usbDevice()
+		if err != nil {
+			return false
+		}
+
+		actual, err := usb.PortPath()
+		return err == nil && actual == portPath
+	}
+}
+
+// MatchInterfaceNumber selects the interfaces provided by the USB interface
+// with the given number, such as one of the serial ports of a composite
+// device.
+func MatchInterfaceNumber(number int) Filter {
+	return func(devIf *DeviceInterface) bool {
+		actual, err := devIf.Device.InterfaceNumber()
+		return err == nil && actual == number
+	}
+}
+
+// MatchStableID selects the interfaces of USB devices with the given stable
+// ID, as returned by Device.StableID or, if it starts with the same vendor
+// and product IDs, Device.StableIDUsing.
+func MatchStableID(id string) Filter {
+	return func(devIf *DeviceInterface) bool {
+		usb, err := devIf.Device.usbDevice()
+		if err != nil {
+			return false
+		}
+
+		for _, strategy := range []IdentityStrategy{IdentitySerial, IdentityPort} {
+			actual, err := usb.StableIDUsing(strategy)
+			if err == nil && actual == id {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,651 @@
+package hotplug
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A FilterSyntaxError describes a mistake in a filter expression.
+type FilterSyntaxError struct {
+	Expr string
+
+	// Offset is the byte offset in Expr at which the mistake was found.
+	Offset int
+
+	Msg string
+}
+
+func (e *FilterSyntaxError) Error() string {
+	return "invalid filter expression at column " + strconv.Itoa(e.Offset+1) + ": " + e.Msg
+}
+
+// ParseFilter compiles a filter expression, so that which interfaces are of
+// interest can be configured rather than written in Go. For example:
+//
+//	subsystem == "hidraw" && usb.vid == 0x1234 && usb.serial =~ "^AB"
+//
+// An expression compares fields of the interface with literals or other
+// fields using ==, !=, <, <=, >, >=, =~ (matches a regular expression) and
+// !~ (doesn't match), and combines comparisons with &&, || and !, grouped
+// with parentheses. A field on its own checks that it is present and not
+// empty. Strings are written in double quotes or backquotes, with Go's
+// escapes, and numbers in decimal or hexadecimal with a 0x prefix.
+//
+// Fields are written as an optional scope followed by a name. The scopes
+// are:
+//
+//	(none)    the interface itself
+//	device    the Device providing the interface
+//	parent    the parent of that Device
+//	usb       the USB device providing the interface
+//	ancestor  the Device or the nearest of its ancestors which has the
+//	          field, like the ATTRS key of a udev rule
+//
+// The names are:
+//
+//	class         the class name, as returned by String
+//	path          the path of the interface or device
+//	subsystem     the kernel subsystem, e.g. "hidraw" or "usb"
+//	devtype       the kernel device type, e.g. "usb_device"
+//	driver        the name of the bound driver
+//	vid, pid      the USB vendor and product IDs, as numbers
+//	serial        the USB serial number
+//	port          the USB port path, as returned by Device.PortPath
+//	stable_id     the stable ID, as returned by Device.StableID
+//	port_label    the label of the port, as returned by Device.PortLabel
+//	bus, address  the bus number and address, as numbers
+//	property.KEY  the udev property KEY, as returned by Device.Property
+//	attr.NAME     the sysfs attribute NAME, as returned by Device.Attribute
+//
+// Comparisons with a field which isn't available, such as usb.vid for an
+// interface which isn't provided by a USB device, are false, so use ! to
+// select interfaces which don't have a value. When a text field is compared
+// with a number it is read as a number, in hexadecimal if it has a 0x
+// prefix; note that sysfs attributes such as idVendor hold hexadecimal
+// without a prefix, so compare them with strings instead.
+//
+// The Filter may be given to a Listener with WithFilter, or to List, Find or
+// Inventory.Select. A mistake in the expression is reported as a
+// *FilterSyntaxError.
+func ParseFilter(expr string) (Filter, error) {
+	p := &exprParser{src: expr}
+	err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	match, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.tok.kind != exprEOF {
+		return nil, p.fail(p.tok.pos, "unexpected "+p.tok.describe())
+	}
+
+	return Filter(match), nil
+}
+
+type exprTokenKind int
+
+const (
+	exprEOF exprTokenKind = iota
+	exprIdent
+	exprString
+	exprNumber
+	exprOp
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	pos  int
+
+	// text is the token as written, or the value of a string
+	text string
+	num  int64
+}
+
+func (tok *exprToken) describe() string {
+	switch tok.kind {
+	case exprEOF:
+		return "end of expression"
+	case exprString:
+		return "string " + strconv.Quote(tok.text)
+	default:
+		return strconv.Quote(tok.text)
+	}
+}
+
+// exprOps lists the operators, longest first so that they are matched
+// greedily.
+var exprOps = []string{"==", "!=", "<=", ">=", "=~", "!~", "&&", "||", "<", ">", "!", "(", ")"}
+
+var exprComparisons = map[string]bool{
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+	"=~": true, "!~": true,
+}
+
+type exprParser struct {
+	src string
+	off int
+	tok exprToken
+}
+
+func (p *exprParser) fail(pos int, msg string) error {
+	return &FilterSyntaxError{Expr: p.src, Offset: pos, Msg: msg}
+}
+
+// next reads the next token into p.tok.
+func (p *exprParser) next() error {
+	for p.off < len(p.src) && strings.ContainsRune(" \t\r\n", rune(p.src[p.off])) {
+		p.off++
+	}
+
+	start := p.off
+	if start == len(p.src) {
+		p.tok = exprToken{kind: exprEOF, pos: start}
+		return nil
+	}
+
+	c := p.src[start]
+	switch {
+	case c == '_' || isLetter(c):
+		for p.off < len(p.src) && (p.src[p.off] == '_' || p.src[p.off] == '.' ||
+			isLetter(p.src[p.off]) || isDigit(p.src[p.off])) {
+			p.off++
+		}
+		p.tok = exprToken{kind: exprIdent, pos: start, text: p.src[start:p.off]}
+
+	case isDigit(c):
+		for p.off < len(p.src) && (isLetter(p.src[p.off]) || isDigit(p.src[p.off])) {
+			p.off++
+		}
+		text := p.src[start:p.off]
+		num, err := parseExprNumber(text)
+		if err != nil {
+			return p.fail(start, "invalid number "+strconv.Quote(text))
+		}
+		p.tok = exprToken{kind: exprNumber, pos: start, text: text, num: num}
+
+	case c == '"' || c == '`':
+		p.off++
+		for p.off < len(p.src) && p.src[p.off] != c {
+			if c == '"' && p.src[p.off] == '\\' {
+				p.off++
+			}
+			p.off++
+		}
+		if p.off >= len(p.src) {
+			return p.fail(start, "unterminated string")
+		}
+		p.off++
+
+		text, err := strconv.Unquote(p.src[start:p.off])
+		if err != nil {
+			return p.fail(start, "invalid string "+p.src[start:p.off])
+		}
+		p.tok = exprToken{kind: exprString, pos: start, text: text}
+
+	default:
+		for _, op := range exprOps {
+			if strings.HasPrefix(p.src[start:], op) {
+				p.off += len(op)
+				p.tok = exprToken{kind: exprOp, pos: start, text: op}
+				return nil
+			}
+		}
+		return p.fail(start, "unexpected character "+strconv.QuoteRune(rune(c)))
+	}
+
+	return nil
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func (p *exprParser) isOp(op string) bool {
+	return p.tok.kind == exprOp && p.tok.text == op
+}
+
+func (p *exprParser) parseOr() (Filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOp("||") {
+		err = p.next()
+		if err != nil {
+			return nil, err
+		}
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		a, b := left, right
+		left = func(devIf *DeviceInterface) bool {
+			return a(devIf) || b(devIf)
+		}
+	}
+
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (Filter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOp("&&") {
+		err = p.next()
+		if err != nil {
+			return nil, err
+		}
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		a, b := left, right
+		left = func(devIf *DeviceInterface) bool {
+			return a(devIf) && b(devIf)
+		}
+	}
+
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (Filter, error) {
+	if p.isOp("!") {
+		err := p.next()
+		if err != nil {
+			return nil, err
+		}
+
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return func(devIf *DeviceInterface) bool {
+			return !inner(devIf)
+		}, nil
+	}
+
+	if p.isOp("(") {
+		open := p.tok.pos
+		err := p.next()
+		if err != nil {
+			return nil, err
+		}
+
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if !p.isOp(")") {
+			return nil, p.fail(p.tok.pos, "expected ) to match ( at column "+
+				strconv.Itoa(open+1)+", found "+p.tok.describe())
+		}
+
+		return inner, p.next()
+	}
+
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (Filter, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.tok.kind != exprOp || !exprComparisons[p.tok.text] {
+		if left.get == nil {
+			return nil, p.fail(p.tok.pos, "expected a comparison operator, found "+
+				p.tok.describe())
+		}
+
+		// a field on its own checks that it has a value
+		return func(devIf *DeviceInterface) bool {
+			val, ok := left.get(devIf)
+			return ok && (left.number || val.str != "")
+		}, nil
+	}
+
+	op := p.tok
+	err = p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.compare(left, op, right)
+}
+
+// exprValue is the value of an operand, which is text or a number.
+type exprValue struct {
+	str string
+	num int64
+}
+
+// exprOperand is a field or literal in a comparison.
+type exprOperand struct {
+	tok exprToken
+
+	// number is true if the operand's value is a number
+	number bool
+
+	// get looks up the value of a field, or is nil for a literal
+	get func(devIf *DeviceInterface) (exprValue, bool)
+
+	// value is the value of a literal
+	value exprValue
+}
+
+func (operand *exprOperand) eval(devIf *DeviceInterface) (exprValue, bool) {
+	if operand.get == nil {
+		return operand.value, true
+	}
+
+	return operand.get(devIf)
+}
+
+func (p *exprParser) parseOperand() (*exprOperand, error) {
+	tok := p.tok
+	operand := &exprOperand{tok: tok}
+
+	switch tok.kind {
+	case exprIdent:
+		get, number, err := exprField(tok.text)
+		if err != nil {
+			return nil, p.fail(tok.pos, err.Error())
+		}
+		operand.get = get
+		operand.number = number
+
+	case exprString:
+		operand.value.str = tok.text
+
+	case exprNumber:
+		operand.number = true
+		operand.value.num = tok.num
+
+	default:
+		return nil, p.fail(tok.pos, "expected a field, string or number, found "+
+			tok.describe())
+	}
+
+	return operand, p.next()
+}
+
+func (p *exprParser) compare(left *exprOperand, op exprToken, right *exprOperand) (Filter, error) {
+	if left.get == nil && right.get == nil {
+		return nil, p.fail(op.pos, op.text+" compares two literals")
+	}
+
+	if op.text == "=~" || op.text == "!~" {
+		if left.get == nil || left.number {
+			return nil, p.fail(left.tok.pos, op.text+" needs a text field on the left")
+		}
+		if right.get != nil || right.tok.kind != exprString {
+			return nil, p.fail(right.tok.pos, op.text+" needs a string on the right")
+		}
+
+		re, err := regexp.Compile(right.value.str)
+		if err != nil {
+			return nil, p.fail(right.tok.pos, "invalid regular expression: "+err.Error())
+		}
+
+		want := op.text == "=~"
+		return func(devIf *DeviceInterface) bool {
+			val, ok := left.get(devIf)
+			return ok && re.MatchString(val.str) == want
+		}, nil
+	}
+
+	// a number field can't sensibly be compared with text, although a text
+	// field can hold a number
+	for _, pair := range [][2]*exprOperand{{left, right}, {right, left}} {
+		if pair[0].get != nil && pair[0].number && pair[1].get == nil && !pair[1].number {
+			return nil, p.fail(pair[1].tok.pos, "cannot compare number field "+
+				pair[0].tok.text+" with a string")
+		}
+	}
+
+	var test func(cmp int) bool
+	switch op.text {
+	case "==":
+		test = func(cmp int) bool { return cmp == 0 }
+	case "!=":
+		test = func(cmp int) bool { return cmp != 0 }
+	case "<":
+		test = func(cmp int) bool { return cmp < 0 }
+	case "<=":
+		test = func(cmp int) bool { return cmp <= 0 }
+	case ">":
+		test = func(cmp int) bool { return cmp > 0 }
+	case ">=":
+		test = func(cmp int) bool { return cmp >= 0 }
+	}
+
+	numeric := left.number || right.number
+	return func(devIf *DeviceInterface) bool {
+		a, ok := left.eval(devIf)
+		if !ok {
+			return false
+		}
+
+		b, ok := right.eval(devIf)
+		if !ok {
+			return false
+		}
+
+		if !numeric {
+			return test(strings.Compare(a.str, b.str))
+		}
+
+		x, ok := exprNumberValue(left, a)
+		if !ok {
+			return false
+		}
+
+		y, ok := exprNumberValue(right, b)
+		if !ok {
+			return false
+		}
+
+		switch {
+		case x < y:
+			return test(-1)
+		case x > y:
+			return test(1)
+		default:
+			return test(0)
+		}
+	}, nil
+}
+
+// exprNumberValue reads the value of an operand as a number.
+func exprNumberValue(operand *exprOperand, val exprValue) (int64, bool) {
+	if operand.number {
+		return val.num, true
+	}
+
+	num, err := parseExprNumber(strings.TrimSpace(val.str))
+	return num, err == nil
+}
+
+// parseExprNumber reads a number in hexadecimal if it has a 0x prefix and
+// otherwise in decimal, so that leading zeros, as in the bus number "001",
+// don't make it octal.
+func parseExprNumber(text string) (int64, error) {
+	if len(text) > 2 && text[0] == '0' && (text[1] == 'x' || text[1] == 'X') {
+		return strconv.ParseInt(text[2:], 16, 64)
+	}
+	return strconv.ParseInt(text, 10, 64)
+}
+
+// exprScopes finds the device a field is looked up on.
+var exprScopes = map[string]func(devIf *DeviceInterface) *Device{
+	"device": func(devIf *DeviceInterface) *Device {
+		return devIf.Device
+	},
+	"parent": func(devIf *DeviceInterface) *Device {
+		parent, err := devIf.Device.Parent()
+		if err != nil {
+			return nil
+		}
+		return parent
+	},
+	"usb": func(devIf *DeviceInterface) *Device {
+		usb, err := devIf.Device.usbDevice()
+		if err != nil {
+			return nil
+		}
+		return usb
+	},
+}
+
+// exprField resolves the name of a field to a function which looks up its
+// value, also reporting whether the value is a number.
+func exprField(name string) (
+	get func(devIf *DeviceInterface) (exprValue, bool),
+	number bool,
+	err error,
+) {
+	scope, rest, scoped := strings.Cut(name, ".")
+	if !scoped || (exprScopes[scope] == nil && scope != "ancestor") {
+		scope, rest = "", name
+	}
+
+	getDev, number, err := exprDeviceField(rest)
+	if err != nil {
+		return nil, false, errors.New("unknown field " + strconv.Quote(name))
+	}
+
+	switch scope {
+	case "":
+		// the interface's own class and path differ from its node's
+		switch rest {
+		case "class":
+			return func(devIf *DeviceInterface) (exprValue, bool) {
+				return exprValue{str: devIf.Class.String()}, true
+			}, false, nil
+		case "path":
+			return func(devIf *DeviceInterface) (exprValue, bool) {
+				return exprValue{str: devIf.Path}, true
+			}, false, nil
+		}
+
+		return func(devIf *DeviceInterface) (exprValue, bool) {
+			return getDev(devIf.node())
+		}, number, nil
+
+	case "ancestor":
+		return func(devIf *DeviceInterface) (exprValue, bool) {
+			for dev := devIf.Device; dev != nil; {
+				if val, ok := getDev(dev); ok {
+					return val, true
+				}
+
+				parent, err := dev.Parent()
+				if err != nil {
+					break
+				}
+				dev = parent
+			}
+			return exprValue{}, false
+		}, number, nil
+
+	default:
+		find := exprScopes[scope]
+		return func(devIf *DeviceInterface) (exprValue, bool) {
+			dev := find(devIf)
+			if dev == nil {
+				return exprValue{}, false
+			}
+			return getDev(dev)
+		}, number, nil
+	}
+}
+
+// exprDeviceField resolves the name of a field of a Device.
+func exprDeviceField(name string) (
+	get func(dev *Device) (exprValue, bool),
+	number bool,
+	err error,
+) {
+	text := func(lookup func(dev *Device) (string, error)) func(dev *Device) (exprValue, bool) {
+		return func(dev *Device) (exprValue, bool) {
+			val, err := lookup(dev)
+			return exprValue{str: val}, err == nil
+		}
+	}
+
+	num := func(lookup func(dev *Device) (int, error)) func(dev *Device) (exprValue, bool) {
+		return func(dev *Device) (exprValue, bool) {
+			val, err := lookup(dev)
+			return exprValue{num: int64(val)}, err == nil
+		}
+	}
+
+	property := func(key string) func(dev *Device) (exprValue, bool) {
+		return text(func(dev *Device) (string, error) { return dev.Property(key) })
+	}
+
+	if key, ok := strings.CutPrefix(name, "property."); ok && key != "" {
+		return property(key), false, nil
+	}
+
+	if attr, ok := strings.CutPrefix(name, "attr."); ok && attr != "" {
+		return text(func(dev *Device) (string, error) { return dev.Attribute(attr) }), false, nil
+	}
+
+	switch name {
+	case "class":
+		return func(dev *Device) (exprValue, bool) {
+			return exprValue{str: dev.Class.String()}, true
+		}, false, nil
+	case "path":
+		return func(dev *Device) (exprValue, bool) {
+			return exprValue{str: dev.Path}, true
+		}, false, nil
+	case "subsystem":
+		return property("SUBSYSTEM"), false, nil
+	case "devtype":
+		return property("DEVTYPE"), false, nil
+	case "driver":
+		return property("DRIVER"), false, nil
+	case "vid":
+		return num((*Device).VendorId), true, nil
+	case "pid":
+		return num((*Device).ProductId), true, nil
+	case "serial":
+		return text((*Device).SerialNumber), false, nil
+	case "port":
+		return text((*Device).PortPath), false, nil
+	case "stable_id":
+		return text((*Device).StableID), false, nil
+	case "port_label":
+		return text((*Device).PortLabel), false, nil
+	case "bus":
+		return num((*Device).BusNumber), true, nil
+	case "address":
+		return num((*Device).Address), true, nil
+	}
+
+	return nil, false, errors.New("unknown field " + strconv.Quote(name))
+}
@@ -0,0 +1,94 @@
+package hotplug
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, test := range []struct {
+		expr   string
+		offset int
+		msg    string
+	}{
+		{"", 0, "expected a field, string or number, found end of expression"},
+		{"usb.vid ==", 10, "expected a field, string or number, found end of expression"},
+		{"usb.vid == 1 &&", 15, "expected a field, string or number, found end of expression"},
+		{"usb.vid == 0x12g", 11, `invalid number "0x12g"`},
+		{`serial == "abc`, 10, "unterminated string"},
+		{"vid @ 1", 4, "unexpected character '@'"},
+		{"vid 1", 4, `unexpected "1"`},
+		{"vid == 1 )", 9, `unexpected ")"`},
+		{"(vid == 1", 9, "expected ) to match ( at column 1, found end of expression"},
+		{"1 == 2", 2, "== compares two literals"},
+		{`vid =~ "a"`, 0, "=~ needs a text field on the left"},
+		{"serial =~ 1", 10, "=~ needs a string on the right"},
+		{`vid == "abc"`, 7, "cannot compare number field vid with a string"},
+		{"bogus == 1", 0, `unknown field "bogus"`},
+		{"usb.bogus == 1", 0, `unknown field "usb.bogus"`},
+	} {
+		_, err := ParseFilter(test.expr)
+
+		var syntaxErr *FilterSyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("%q: got %v, want a *FilterSyntaxError", test.expr, err)
+			continue
+		}
+		if syntaxErr.Expr != test.expr || syntaxErr.Offset != test.offset || syntaxErr.Msg != test.msg {
+			t.Errorf("%q: got error at %d: %s, want at %d: %s",
+				test.expr, syntaxErr.Offset, syntaxErr.Msg, test.offset, test.msg)
+		}
+	}
+}
+
+func TestFilterSyntaxErrorMessage(t *testing.T) {
+	_, err := ParseFilter("vid @ 1")
+	want := "invalid filter expression at column 5: unexpected character '@'"
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v, want %q", err, want)
+	}
+}
+
+func TestParseFilterValid(t *testing.T) {
+	for _, expr := range []string{
+		"vid",
+		"!usb.serial",
+		`usb.vid == 0x046d && usb.pid != 49963`,
+		`(usb.vid == 1 || usb.vid == 2) && !(port =~ "^1-")`,
+		"usb.serial =~ `^AB[0-9]+$` || usb.serial !~ \"\\\\d\"",
+		`device.subsystem == parent.subsystem`,
+		`ancestor.attr.bDeviceClass >= 0x09 && property.ID_BUS == "usb"`,
+		"bus <= 3 && address > 1 && address < 128",
+	} {
+		_, err := ParseFilter(expr)
+		if err != nil {
+			t.Errorf("%q: %s", expr, err.Error())
+		}
+	}
+}
+
+func TestParseExprNumber(t *testing.T) {
+	for _, test := range []struct {
+		text string
+		want int64
+		ok   bool
+	}{
+		{"10", 10, true},
+		{"010", 10, true},
+		{"09", 9, true},
+		{"001", 1, true},
+		{"0x10", 16, true},
+		{"0X1f", 31, true},
+		{"0x046d", 0x46d, true},
+		{"-5", -5, true},
+		{"0x", 0, false},
+		{"0o7", 0, false},
+		{"0b1", 0, false},
+		{"1_000", 0, false},
+	} {
+		got, err := parseExprNumber(test.text)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("%q: got %d, %v, want %d", test.text, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+//go:build linux
+
+package hotplug
+
+import (
+	"testing"
+)
+
+func TestParseFilterMatches(t *testing.T) {
+	devIf, err := Find(DevIfHid, nil, FromCapture(loadCapture(t, "hidraw.db", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		expr string
+		want bool
+	}{
+		{`class == "hid"`, true},
+		{`path == "/dev/hidraw0"`, true},
+		{`subsystem == "hidraw"`, true},
+		{`device.subsystem == "hid" && device.driver == "hid-generic"`, true},
+		{`parent.devtype == "usb_interface" && parent.driver == "usbhid"`, true},
+		{"usb.vid == 0x046d && usb.pid == 0xc52b", true},
+		{"usb.vid == 0x046d && usb.pid == 0xc52c", false},
+		{"usb.vid == 0x1234 || usb.pid == 0xc52b", true},
+		{"!(usb.vid == 0x046d)", false},
+		{"usb.vid >= 0x1000 && usb.vid < 0x2000", false},
+		{`usb.serial == "ABC123"`, true},
+		{`usb.serial =~ "^AB"`, true},
+		{`usb.serial !~ "^AB"`, false},
+		{`usb.port == "1-2"`, true},
+		{"usb.bus == 1 && usb.address == 5", true},
+		// leading zeros are decimal, not octal
+		{"usb.property.BUSNUM == 1 && usb.property.DEVNUM == 005", true},
+		{"usb.address == 010", false},
+		{`usb.devtype == "usb_device"`, true},
+		{`usb.property.ID_SERIAL_SHORT == "ABC123"`, true},
+		{`ancestor.attr.idVendor == "046d"`, true},
+		// idVendor holds hexadecimal without a prefix, so it reads as 46
+		{`ancestor.attr.idVendor == 0x046d`, false},
+		{"usb.serial", true},
+		{"driver", false},
+		{"!driver", true},
+		{`property.ID_MISSING == ""`, false},
+	} {
+		filter, err := ParseFilter(test.expr)
+		if err != nil {
+			t.Errorf("%q: %s", test.expr, err.Error())
+			continue
+		}
+
+		if got := filter.Matches(devIf); got != test.want {
+			t.Errorf("%q: got %t, want %t", test.expr, got, test.want)
+		}
+	}
+}
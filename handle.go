@@ -0,0 +1,323 @@
+package hotplug
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// ErrDisconnected is matched by a *DisconnectedError with errors.Is.
+var ErrDisconnected = errors.New("device is disconnected")
+
+// A DisconnectedError is returned by the methods of a Handle while the
+// device it tracks is unavailable.
+type DisconnectedError struct {
+	// ID is the stable ID of the device.
+	ID string
+
+	// Err is the error which made the device unavailable, if it was
+	// present but couldn't be used, or nil if it was removed.
+	Err error
+}
+
+func (e *DisconnectedError) Error() string {
+	if e.Err != nil {
+		return "device " + e.ID + " is disconnected: " + e.Err.Error()
+	}
+	return "device " + e.ID + " is disconnected"
+}
+
+func (e *DisconnectedError) Is(target error) bool {
+	return target == ErrDisconnected
+}
+
+func (e *DisconnectedError) Unwrap() error {
+	return e.Err
+}
+
+// HandleConfig configures a Handle.
+type HandleConfig struct {
+	Class InterfaceClass
+
+	// ID is the stable ID of the device, as returned by Device.StableID or
+	// Device.StableIDUsing.
+	ID string
+
+	// Interface, if not nil, selects which of the device's interfaces of
+	// the class to use, such as MatchInterfaceNumber(2) for one of the
+	// serial ports of a composite device. Otherwise the first to arrive is
+	// used, so if the device has several, which one depends on the order in
+	// which they arrive. If the interface in use is removed while another
+	// selected interface is present, the Handle switches to that one.
+	Interface Filter
+
+	// Open, if not nil, opens the device node of an interface. By default
+	// the node at the interface's Path is opened for reading and writing.
+	Open func(devIf *DeviceInterface) (io.ReadWriteCloser, error)
+}
+
+// A Handle is an io.ReadWriteCloser for the device node of a device which
+// survives the device being unplugged and plugged back in.
+//
+// While the device is gone, reads and writes fail immediately with a
+// *DisconnectedError. Once the device returns, the next read or write
+// reopens its device node and carries on. A read or write which fails
+// because the device node has stopped working, as usually happens just
+// before its removal is reported, also returns a *DisconnectedError, and
+// the node is reopened by the next read or write if the device is still
+// present. Other errors, such as io.EOF or os.ErrDeadlineExceeded, are
+// returned as they are and the node is kept open.
+//
+// A Handle is safe for concurrent use by multiple goroutines, but as with
+// any file, concurrent reads or writes may interleave.
+type Handle struct {
+	config   HandleConfig
+	filter   Filter
+	listener *Listener
+
+	// lock protects the fields below
+	lock   sync.Mutex
+	closed bool
+	devIf  *DeviceInterface
+	file   io.ReadWriteCloser
+
+	// present lists the selected interfaces which are present, in the
+	// order in which they arrived, including the one in use
+	present []*DeviceInterface
+
+	// changed is closed and replaced whenever the device arrives or is
+	// removed
+	changed chan struct{}
+}
+
+// OpenHandle creates a Handle and starts tracking the device. It succeeds
+// even if the device isn't present. The options are passed to New.
+func OpenHandle(config HandleConfig, options ...Option) (*Handle, error) {
+	if config.ID == "" {
+		return nil, errors.New("handle needs the stable ID of a device")
+	}
+
+	if config.Open == nil {
+		config.Open = func(devIf *DeviceInterface) (io.ReadWriteCloser, error) {
+			return os.OpenFile(devIf.Path, os.O_RDWR, 0)
+		}
+	}
+
+	h := &Handle{
+		config:  config,
+		filter:  MatchAll(MatchStableID(config.ID), config.Interface),
+		changed: make(chan struct{}),
+	}
+
+	l, err := New(config.Class, h.arrive, options...)
+	if err != nil {
+		return nil, err
+	}
+	h.listener = l
+
+	err = l.Start()
+	if err != nil {
+		l.Stop()
+		return nil, err
+	}
+
+	return h, nil
+}
+
+func (h *Handle) arrive(devIf *DeviceInterface) {
+	if !h.filter.Matches(devIf) {
+		return
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.closed {
+		return
+	}
+
+	// if several interfaces are selected, stick with the first and keep
+	// the others to fall back on
+	h.present = append(h.present, devIf)
+	if h.devIf == nil {
+		h.devIf = devIf
+		h.notify()
+	}
+
+	devIf.OnDetach(func() {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+
+		for i, other := range h.present {
+			if other == devIf {
+				h.present = append(h.present[:i], h.present[i+1:]...)
+				break
+			}
+		}
+
+		if h.devIf != devIf {
+			return
+		}
+
+		h.devIf = nil
+		if len(h.present) > 0 {
+			h.devIf = h.present[0]
+		}
+		if h.file != nil {
+			h.file.Close()
+			h.file = nil
+		}
+		h.notify()
+	})
+}
+
+// notify wakes anything waiting for the device to arrive or be removed. It
+// must be called with the lock held.
+func (h *Handle) notify() {
+	close(h.changed)
+	h.changed = make(chan struct{})
+}
+
+// Connected reports whether the device is present.
+func (h *Handle) Connected() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.devIf != nil
+}
+
+// Interface returns the interface through which the device is currently
+// reached, or nil if it isn't present.
+func (h *Handle) Interface() *DeviceInterface {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.devIf
+}
+
+// WaitConnected blocks until the device is present. It gives up when the
+// context is done, returning its error.
+func (h *Handle) WaitConnected(ctx context.Context) error {
+	for {
+		h.lock.Lock()
+		closed, present, changed := h.closed, h.devIf != nil, h.changed
+		h.lock.Unlock()
+
+		if closed {
+			return os.ErrClosed
+		} else if present {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// current returns the open device node, opening it if necessary.
+func (h *Handle) current() (io.ReadWriteCloser, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.closed {
+		return nil, os.ErrClosed
+	}
+
+	if h.devIf == nil {
+		return nil, &DisconnectedError{ID: h.config.ID}
+	}
+
+	if h.file == nil {
+		file, err := h.config.Open(h.devIf)
+		if err != nil {
+			return nil, &DisconnectedError{ID: h.config.ID, Err: err}
+		}
+		h.file = file
+	}
+
+	return h.file, nil
+}
+
+// failed handles an error from a device node. If it means the device has
+// stopped working, or the device has been removed meanwhile, the node is
+// closed, unless it has already been replaced, and a *DisconnectedError is
+// returned. Other errors are returned as they are.
+func (h *Handle) failed(file io.ReadWriteCloser, err error) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.closed {
+		return os.ErrClosed
+	}
+
+	// the node is closed and forgotten when the device is removed
+	if h.file == file && !isDisconnectError(err) {
+		return err
+	}
+
+	if h.file == file {
+		h.file.Close()
+		h.file = nil
+	}
+
+	return &DisconnectedError{ID: h.config.ID, Err: err}
+}
+
+func (h *Handle) Read(p []byte) (int, error) {
+	file, err := h.current()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := file.Read(p)
+	if err != nil {
+		err = h.failed(file, err)
+	}
+	return n, err
+}
+
+func (h *Handle) Write(p []byte) (int, error) {
+	file, err := h.current()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := file.Write(p)
+	if err != nil {
+		err = h.failed(file, err)
+	}
+	return n, err
+}
+
+// Close stops tracking the device and closes its device node. Reads and
+// writes which are in progress are interrupted.
+func (h *Handle) Close() error {
+	h.lock.Lock()
+	if h.closed {
+		h.lock.Unlock()
+		return os.ErrClosed
+	}
+	h.closed = true
+	h.devIf = nil
+	h.present = nil
+	file := h.file
+	h.file = nil
+	h.notify()
+	h.lock.Unlock()
+
+	var err error
+	if file != nil {
+		err = file.Close()
+	}
+
+	stopErr := h.listener.Stop()
+	if err == nil {
+		err = stopErr
+	}
+	return err
+}
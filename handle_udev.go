@@ -0,0 +1,14 @@
+//go:build linux
+
+package hotplug
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isDisconnectError reports whether an error from a device node means the
+// device has stopped working, as happens when it is unplugged.
+func isDisconnectError(err error) bool {
+	return errors.Is(err, syscall.ENODEV) || errors.Is(err, syscall.EIO)
+}
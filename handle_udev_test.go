@@ -0,0 +1,254 @@
+//go:build linux
+
+package hotplug
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeNode stands in for an open device node.
+type fakeNode struct {
+	path string
+
+	lock    sync.Mutex
+	err     error
+	written []byte
+	closed  bool
+}
+
+func (node *fakeNode) Read(p []byte) (int, error) {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+
+	if node.err != nil {
+		return 0, node.err
+	}
+	return copy(p, node.path), nil
+}
+
+func (node *fakeNode) Write(p []byte) (int, error) {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+
+	if node.err != nil {
+		return 0, node.err
+	}
+	node.written = append(node.written, p...)
+	return len(p), nil
+}
+
+func (node *fakeNode) Close() error {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+
+	node.closed = true
+	return nil
+}
+
+// openFakeHandle opens a Handle for the receiver in hidraw.db whose device
+// nodes are fakeNodes, which are sent to the returned channel as they are
+// opened.
+func openFakeHandle(t *testing.T, config HandleConfig, capture *Capture) (*Handle, <-chan *fakeNode) {
+	t.Helper()
+
+	nodes := make(chan *fakeNode, 10)
+	config.Class = DevIfHid
+	config.ID = "046d:c52b:ABC123"
+	config.Open = func(devIf *DeviceInterface) (io.ReadWriteCloser, error) {
+		node := &fakeNode{path: devIf.Path}
+		nodes <- node
+		return node, nil
+	}
+
+	h, err := OpenHandle(config, FromCapture(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+
+	return h, nodes
+}
+
+// readPath reads from the Handle, which yields the path of the interface
+// the fake node was opened for.
+func readPath(h *Handle) (string, error) {
+	buf := make([]byte, 100)
+	n, err := h.Read(buf)
+	return string(buf[:n]), err
+}
+
+func TestHandleReadWrite(t *testing.T) {
+	h, nodes := openFakeHandle(t, HandleConfig{}, loadCapture(t, "hidraw.db", ""))
+
+	if !h.Connected() || h.Interface().Path != "/dev/hidraw0" {
+		t.Fatalf("got interface %v, want hidraw0", h.Interface())
+	}
+
+	path, err := readPath(h)
+	if err != nil || path != "/dev/hidraw0" {
+		t.Errorf("got %q, %v, want to read from hidraw0", path, err)
+	}
+
+	_, err = h.Write([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := <-nodes
+	if string(node.written) != "hello" {
+		t.Errorf("got %q written, want hello", node.written)
+	}
+
+	// an error which doesn't mean the device has gone keeps the node open
+	node.err = io.EOF
+	_, err = readPath(h)
+	if err != io.EOF {
+		t.Errorf("got %v, want io.EOF", err)
+	}
+
+	// one which does closes it, and the next read opens it again
+	node.err = syscall.EIO
+	_, err = readPath(h)
+	if !errors.Is(err, ErrDisconnected) || !errors.Is(err, syscall.EIO) {
+		t.Errorf("got %v, want a DisconnectedError for EIO", err)
+	}
+	if !node.closed {
+		t.Error("the failed node wasn't closed")
+	}
+
+	_, err = readPath(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 {
+		t.Error("the node wasn't reopened")
+	}
+
+	err = h.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = readPath(h)
+	if err != os.ErrClosed {
+		t.Errorf("got %v after Close, want os.ErrClosed", err)
+	}
+	if h.Close() != os.ErrClosed {
+		t.Error("second Close succeeded")
+	}
+}
+
+func TestHandleRemoval(t *testing.T) {
+	h, _ := openFakeHandle(t, HandleConfig{}, loadCapture(t, "hidraw.db", "hidraw.events"))
+
+	waitDisconnected(t, h)
+
+	_, err := readPath(h)
+	var disconnected *DisconnectedError
+	if !errors.As(err, &disconnected) || disconnected.ID != "046d:c52b:ABC123" || disconnected.Err != nil {
+		t.Errorf("got %v, want a DisconnectedError for the removal", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = h.WaitConnected(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("got %v from WaitConnected, want the context's error", err)
+	}
+}
+
+// waitDisconnected waits for the Handle's device to be removed.
+func waitDisconnected(t *testing.T, h *Handle) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for h.Connected() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the device to be removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// secondInterface adds a second HID interface, hidraw2, to the receiver in
+// hidraw.db and then removes the first.
+const secondInterface = `UDEV  [1.0] add      /devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.1 (usb)
+ACTION=add
+DEVPATH=/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.1
+SUBSYSTEM=usb
+DEVTYPE=usb_interface
+DRIVER=usbhid
+SEQNUM=200
+
+UDEV  [1.1] add      /devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.1/0003:046D:C52B.0003 (hid)
+ACTION=add
+DEVPATH=/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.1/0003:046D:C52B.0003
+SUBSYSTEM=hid
+DRIVER=hid-generic
+SEQNUM=201
+
+UDEV  [1.2] add      /devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.1/0003:046D:C52B.0003/hidraw/hidraw2 (hidraw)
+ACTION=add
+DEVPATH=/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.1/0003:046D:C52B.0003/hidraw/hidraw2
+SUBSYSTEM=hidraw
+DEVNAME=/dev/hidraw2
+SEQNUM=202
+
+UDEV  [1.3] remove   /devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.0/0003:046D:C52B.0001/hidraw/hidraw0 (hidraw)
+ACTION=remove
+DEVPATH=/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.0/0003:046D:C52B.0001/hidraw/hidraw0
+SUBSYSTEM=hidraw
+DEVNAME=/dev/hidraw0
+SEQNUM=203
+`
+
+func TestHandleFailover(t *testing.T) {
+	capture := loadCapture(t, "hidraw.db", "")
+	err := capture.ReadMonitor(strings.NewReader(secondInterface))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, nodes := openFakeHandle(t, HandleConfig{}, capture)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for devIf := h.Interface(); devIf == nil || devIf.Path != "/dev/hidraw2"; devIf = h.Interface() {
+		if time.Now().After(deadline) {
+			t.Fatalf("got interface %v, want the handle moved to hidraw2", devIf)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	path, err := readPath(h)
+	if err != nil || path != "/dev/hidraw2" {
+		t.Errorf("got %q, %v, want to read from hidraw2", path, err)
+	}
+	if node := <-nodes; node.path != "/dev/hidraw2" {
+		t.Errorf("opened %s, want hidraw2", node.path)
+	}
+}
+
+func TestHandleInterfaceFilter(t *testing.T) {
+	capture := loadCapture(t, "hidraw.db", "")
+	err := capture.ReadMonitor(strings.NewReader(secondInterface))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the first interface is selected, so its removal disconnects
+	h, _ := openFakeHandle(t, HandleConfig{Interface: MatchInterfaceNumber(0)}, capture)
+	waitDisconnected(t, h)
+}
+
+func TestOpenHandleErrors(t *testing.T) {
+	_, err := OpenHandle(HandleConfig{Class: DevIfHid})
+	if err == nil {
+		t.Error("opened a handle without an ID")
+	}
+}
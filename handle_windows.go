@@ -0,0 +1,16 @@
+//go:build windows
+
+package hotplug
+
+import (
+	"errors"
+	"golang.org/x/sys/windows"
+)
+
+// isDisconnectError reports whether an error from a device node means the
+// device has stopped working, as happens when it is unplugged.
+func isDisconnectError(err error) bool {
+	return errors.Is(err, windows.ERROR_DEVICE_NOT_CONNECTED) ||
+		errors.Is(err, windows.ERROR_DEVICE_REMOVED) ||
+		errors.Is(err, windows.ERROR_GEN_FAILURE)
+}
@@ -0,0 +1,272 @@
+package hotplug
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// usbIDsPaths and pciIDsPaths are where the ID databases are looked for, in
+// order. Distributions don't agree on where to put them.
+var usbIDsPaths = []string{
+	"/usr/share/hwdata/usb.ids",
+	"/usr/share/misc/usb.ids",
+	"/usr/share/usb.ids",
+	"/var/lib/usbutils/usb.ids",
+}
+
+var pciIDsPaths = []string{
+	"/usr/share/hwdata/pci.ids",
+	"/usr/share/misc/pci.ids",
+	"/usr/share/pci.ids",
+}
+
+// An IDDatabase holds the names of vendors and their products, as listed in
+// the usb.ids and pci.ids files maintained at linux-usb.org and
+// pci-ids.ucw.cz.
+type IDDatabase struct {
+	vendors map[int]*idVendor
+}
+
+type idVendor struct {
+	name     string
+	products map[int]string
+}
+
+// ReadIDs parses a usb.ids or pci.ids file. Only the vendors and their
+// products or devices are kept; interfaces, subsystems and the lists of
+// classes and other codes which follow the vendors are skipped.
+func ReadIDs(r io.Reader) (*IDDatabase, error) {
+	db := &IDDatabase{vendors: make(map[int]*idVendor)}
+
+	var vendor *idVendor
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		if line[0] != '\t' {
+			// the other lists start with a keyword, such as "C 00  ...",
+			// and their entries mustn't be taken for products
+			vendor = nil
+			id, name, ok := parseIDLine(line)
+			if ok {
+				vendor = &idVendor{name: name, products: make(map[int]string)}
+				db.vendors[id] = vendor
+			}
+		} else if vendor != nil && (len(line) < 2 || line[1] != '\t') {
+			id, name, ok := parseIDLine(line[1:])
+			if ok {
+				vendor.products[id] = name
+			}
+		}
+	}
+
+	return db, scanner.Err()
+}
+
+// parseIDLine splits a line consisting of four hexadecimal digits, two
+// spaces and a name.
+func parseIDLine(line string) (int, string, bool) {
+	if len(line) < 7 || line[4:6] != "  " {
+		return 0, "", false
+	}
+
+	id, err := strconv.ParseUint(line[:4], 16, 16)
+	if err != nil {
+		return 0, "", false
+	}
+
+	return int(id), strings.TrimSpace(line[6:]), true
+}
+
+// LoadIDs reads a usb.ids or pci.ids file.
+func LoadIDs(name string) (*IDDatabase, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadIDs(file)
+}
+
+// Len returns the number of vendors in the database.
+func (db *IDDatabase) Len() int {
+	if db == nil {
+		return 0
+	}
+	return len(db.vendors)
+}
+
+// VendorName returns the name of a vendor, or an empty string if it isn't
+// listed.
+func (db *IDDatabase) VendorName(vendorId int) string {
+	if db == nil || db.vendors[vendorId] == nil {
+		return ""
+	}
+	return db.vendors[vendorId].name
+}
+
+// ProductName returns the name of a vendor's product, or an empty string if
+// it isn't listed.
+func (db *IDDatabase) ProductName(vendorId int, productId int) string {
+	if db == nil || db.vendors[vendorId] == nil {
+		return ""
+	}
+	return db.vendors[vendorId].products[productId]
+}
+
+// idDatabase is a database which is loaded from the system the first time
+// it is needed, unless one has been set.
+type idDatabase struct {
+	paths []string
+	lock  sync.Mutex
+	db    *IDDatabase
+	done  bool
+}
+
+func (d *idDatabase) get() *IDDatabase {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if !d.done {
+		for _, path := range d.paths {
+			db, err := LoadIDs(path)
+			if err == nil {
+				d.db = db
+				break
+			}
+		}
+		d.done = true
+	}
+
+	return d.db
+}
+
+func (d *idDatabase) set(db *IDDatabase) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.db = db
+	d.done = true
+}
+
+var usbIDs = &idDatabase{paths: usbIDsPaths}
+var pciIDs = &idDatabase{paths: pciIDsPaths}
+
+// UsbIDs returns the USB ID database set with SetUsbIDs, or else the one
+// installed on the system, which is read the first time it is needed. It
+// returns nil if there is none.
+func UsbIDs() *IDDatabase {
+	return usbIDs.get()
+}
+
+// PciIDs returns the PCI ID database set with SetPciIDs, or else the one
+// installed on the system, which is read the first time it is needed. It
+// returns nil if there is none.
+func PciIDs() *IDDatabase {
+	return pciIDs.get()
+}
+
+// SetUsbIDs sets the USB ID database used for the whole program in place of
+// the one installed on the system, such as one loaded with LoadIDs from a
+// copy shipped with the program, so that names are available where the
+// database isn't installed, such as on Windows.
+func SetUsbIDs(db *IDDatabase) {
+	usbIDs.set(db)
+}
+
+// SetPciIDs sets the PCI ID database used for the whole program in place of
+// the one installed on the system, as SetUsbIDs does for USB.
+func SetPciIDs(db *IDDatabase) {
+	pciIDs.set(db)
+}
+
+// VendorName returns the name of the vendor of the USB device providing this
+// device, or of the device itself if it is a PCI device. The name is taken
+// from the ID_VENDOR_FROM_DATABASE udev property, which udev looks up in its
+// hardware database, and failing that, such as on Windows, looked up in the
+// ID database.
+func (dev *Device) VendorName() (string, error) {
+	return dev.idName("vendor", "ID_VENDOR_FROM_DATABASE", func(db *IDDatabase, vendorId int, productId int) string {
+		return db.VendorName(vendorId)
+	})
+}
+
+// ProductName returns the name of the model of the USB device providing this
+// device, or of the device itself if it is a PCI device. The name is taken
+// from the ID_MODEL_FROM_DATABASE udev property, which udev looks up in its
+// hardware database, and failing that, such as on Windows, looked up in the
+// ID database.
+func (dev *Device) ProductName() (string, error) {
+	return dev.idName("product", "ID_MODEL_FROM_DATABASE", func(db *IDDatabase, vendorId int, productId int) string {
+		return db.ProductName(vendorId, productId)
+	})
+}
+
+func (dev *Device) idName(
+	what string,
+	property string,
+	lookup func(db *IDDatabase, vendorId int, productId int) string,
+) (string, error) {
+	target := dev
+	var db *IDDatabase
+	var vendorId, productId int
+	var err error
+
+	if dev.Is(DevPci) {
+		db = PciIDs()
+		vendorId, err = dev.pciID("vendor")
+		if err == nil {
+			productId, err = dev.pciID("device")
+		}
+	} else {
+		target, err = dev.usbDevice()
+		if err != nil {
+			return "", err
+		}
+
+		db = UsbIDs()
+		vendorId, err = target.VendorId()
+		if err == nil {
+			productId, err = target.ProductId()
+		}
+	}
+
+	// prefer udev's name so that the results agree with its tools
+	if name, propErr := target.Property(property); propErr == nil && name != "" {
+		return name, nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if name := lookup(db, vendorId, productId); name != "" {
+		return name, nil
+	}
+
+	return "", errors.New(what + " is not in the ID database")
+}
+
+// pciID reads one of the hexadecimal IDs of a PCI device.
+func (dev *Device) pciID(attr string) (int, error) {
+	val, err := dev.Attribute(attr)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := strconv.ParseUint(strings.TrimSpace(val), 0, 16)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
@@ -0,0 +1,44 @@
+package hotplug
+
+import (
+	"testing"
+)
+
+func TestReadIDs(t *testing.T) {
+	db, err := LoadIDs("testdata/usb.ids")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if db.Len() != 2 {
+		t.Errorf("got %d vendors, want 2", db.Len())
+	}
+
+	for _, test := range []struct {
+		got  string
+		want string
+	}{
+		{db.VendorName(0x046d), "Logitech, Inc."},
+		{db.ProductName(0x046d, 0xc52b), "Unifying Receiver"},
+		{db.VendorName(0x1234), "Brain Actuated Technologies"},
+		{db.ProductName(0x1234, 0x5678), ""},
+		{db.VendorName(0xffff), ""},
+
+		// interfaces aren't products, and the class lists which follow the
+		// vendors aren't vendors
+		{db.ProductName(0x046d, 0x00), ""},
+		{db.VendorName(0x00), ""},
+		{db.VendorName(0x01), ""},
+	} {
+		if test.got != test.want {
+			t.Errorf("got %q, want %q", test.got, test.want)
+		}
+	}
+}
+
+func TestNilIDDatabase(t *testing.T) {
+	var db *IDDatabase
+	if db.Len() != 0 || db.VendorName(0x046d) != "" || db.ProductName(0x046d, 0xc52b) != "" {
+		t.Error("nil database isn't empty")
+	}
+}
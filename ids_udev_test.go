@@ -0,0 +1,74 @@
+//go:build linux
+
+package hotplug
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDeviceNames(t *testing.T) {
+	db, err := LoadIDs("testdata/usb.ids")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := UsbIDs()
+	SetUsbIDs(db)
+	defer SetUsbIDs(previous)
+
+	devIf, err := Find(DevIfHid, nil, FromCapture(loadCapture(t, "hidraw.db", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the names are looked up for the USB device above the interface
+	vendor, err := devIf.Device.VendorName()
+	if err != nil || vendor != "Logitech, Inc." {
+		t.Errorf("got vendor %q, %v, want it from the database", vendor, err)
+	}
+	product, err := devIf.Device.ProductName()
+	if err != nil || product != "Unifying Receiver" {
+		t.Errorf("got product %q, %v, want it from the database", product, err)
+	}
+
+	// udev's names win over the database's
+	capture := &Capture{}
+	err = capture.ReadExportDB(strings.NewReader(`P: /devices/usb1/1-1
+N: bus/usb/001/002
+E: SUBSYSTEM=usb
+E: DEVTYPE=usb_device
+E: ID_VENDOR_ID=046d
+E: ID_MODEL_ID=c52b
+E: ID_VENDOR_FROM_DATABASE=Logitech
+E: ID_MODEL_FROM_DATABASE=Receiver
+
+P: /devices/usb1/1-2
+N: bus/usb/001/003
+E: SUBSYSTEM=usb
+E: DEVTYPE=usb_device
+E: ID_VENDOR_ID=1234
+E: ID_MODEL_ID=5678
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devIfs, err := List(DevIfUsbDevice, nil, FromCapture(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devIfs) != 2 {
+		t.Fatalf("got %d USB devices, want 2", len(devIfs))
+	}
+
+	vendor, _ = devIfs[0].Device.VendorName()
+	product, _ = devIfs[0].Device.ProductName()
+	if vendor != "Logitech" || product != "Receiver" {
+		t.Errorf("got %q %q, want udev's names", vendor, product)
+	}
+
+	_, err = devIfs[1].Device.ProductName()
+	if err == nil || err.Error() != "product is not in the ID database" {
+		t.Errorf("got %v for an unlisted product", err)
+	}
+}
@@ -0,0 +1,72 @@
+package hotplug
+
+import "time"
+
+// InterfaceInfo is a snapshot of the commonly-needed details of a device
+// interface, suitable for display or serialisation. Details which could not
+// be found are left empty.
+type InterfaceInfo struct {
+	Path        string `json:"path"`
+	Class       string `json:"class"`
+	DevicePath  string `json:"device_path"`
+	DeviceClass string `json:"device_class"`
+
+	// the remaining details are those of the USB device providing the
+	// interface, if there is one
+	VendorId     int    `json:"vendor_id,omitempty"`
+	ProductId    int    `json:"product_id,omitempty"`
+	VendorName   string `json:"vendor_name,omitempty"`
+	ProductName  string `json:"product_name,omitempty"`
+	SerialNumber string `json:"serial_number,omitempty"`
+	PortPath     string `json:"port_path,omitempty"`
+	StableID     string `json:"stable_id,omitempty"`
+	BusNumber    int    `json:"bus_number,omitempty"`
+	Address      int    `json:"address,omitempty"`
+
+	// PortLabel is the label of the port, from the labels set with
+	// SetPortLabels.
+	PortLabel    string        `json:"port_label,omitempty"`
+	PortLocation *PortLocation `json:"port_location,omitempty"`
+}
+
+// Info collects an InterfaceInfo for the interface.
+func (devIf *DeviceInterface) Info() InterfaceInfo {
+	info := InterfaceInfo{
+		Path:        devIf.Path,
+		Class:       devIf.Class.String(),
+		DevicePath:  devIf.Device.Path,
+		DeviceClass: devIf.Device.Class.String(),
+	}
+
+	usb, err := devIf.Device.usbDevice()
+	if err != nil {
+		return info
+	}
+
+	info.VendorId, _ = usb.VendorId()
+	info.ProductId, _ = usb.ProductId()
+	info.VendorName, _ = usb.VendorName()
+	info.ProductName, _ = usb.ProductName()
+	info.SerialNumber, _ = usb.SerialNumber()
+	info.PortPath, _ = usb.PortPath()
+	info.StableID, _ = usb.StableID()
+	info.PortLabel, _ = usb.PortLabel()
+	info.PortLocation, _ = usb.PortLocation()
+	info.BusNumber, _ = usb.BusNumber()
+	info.Address, _ = usb.Address()
+	return info
+}
+
+const (
+	ActionArrive = "arrive"
+	ActionRemove = "remove"
+)
+
+// An Event records the arrival or removal of a device interface, suitable
+// for display or serialisation.
+type Event struct {
+	// Action is ActionArrive or ActionRemove.
+	Action    string        `json:"action"`
+	Time      time.Time     `json:"time"`
+	Interface InterfaceInfo `json:"interface"`
+}
@@ -0,0 +1,366 @@
+package hotplug
+
+import "sync"
+
+// An Inventory keeps track of the device interfaces which are present, as
+// reported by a Listener, so that they can be looked up at any time.
+//
+// Pass the Inventory's Add method to New as the callback, or call it from
+// the callback, to feed it:
+//
+//	inventory := hotplug.NewInventory()
+//	listener, err := hotplug.New(hotplug.DevIfHid, inventory.Add)
+//	...
+//	err = listener.Start()
+//
+// Interfaces are removed from the Inventory when they are removed from the
+// system or the Listener is stopped. Interfaces whose removal can't be
+// detected, such as those returned by List, stay until Remove is called.
+//
+// An Inventory is safe for concurrent use by multiple goroutines.
+type Inventory struct {
+	lock        sync.RWMutex
+	items       map[string]*inventoryItem
+	byPath      map[string]map[*inventoryItem]bool
+	byDevpath   map[string]map[*inventoryItem]bool
+	byVidPid    map[[2]int]map[*inventoryItem]bool
+	bySerial    map[string]map[*inventoryItem]bool
+	byPortPath  map[string]map[*inventoryItem]bool
+	subscribers map[*inventorySubscriber]bool
+}
+
+// An InventoryChange describes an interface being added to or removed from
+// an Inventory.
+type InventoryChange struct {
+	// Arrived is true if the interface was added and false if it was removed.
+	Arrived   bool
+	Interface *DeviceInterface
+}
+
+// inventoryItem holds an interface along with the values it is indexed by,
+// which are looked up once on arrival.
+type inventoryItem struct {
+	devIf     *DeviceInterface
+	vendorId  int
+	productId int
+	serial    string
+	portPath  string
+}
+
+func NewInventory() *Inventory {
+	return &Inventory{
+		items:       make(map[string]*inventoryItem),
+		byPath:      make(map[string]map[*inventoryItem]bool),
+		byDevpath:   make(map[string]map[*inventoryItem]bool),
+		byVidPid:    make(map[[2]int]map[*inventoryItem]bool),
+		bySerial:    make(map[string]map[*inventoryItem]bool),
+		byPortPath:  make(map[string]map[*inventoryItem]bool),
+		subscribers: make(map[*inventorySubscriber]bool),
+	}
+}
+
+// Add adds an interface to the Inventory. It has the signature of a
+// ListenerCallback so that it can be passed to New.
+//
+// An interface which is already in the Inventory, such as one reported again
+// by Enumerate, replaces the existing entry, which subscribers see as its
+// removal followed by its arrival.
+func (inv *Inventory) Add(devIf *DeviceInterface) {
+	item := &inventoryItem{devIf: devIf, vendorId: -1, productId: -1}
+	if usb, err := devIf.Device.usbDevice(); err == nil {
+		if vendorId, err := usb.VendorId(); err == nil {
+			item.vendorId = vendorId
+		}
+		if productId, err := usb.ProductId(); err == nil {
+			item.productId = productId
+		}
+		if serial, err := usb.SerialNumber(); err == nil {
+			item.serial = serial
+		}
+		if portPath, err := usb.PortPath(); err == nil {
+			item.portPath = portPath
+		}
+	}
+
+	inv.lock.Lock()
+	if existing := inv.items[devIf.key()]; existing != nil {
+		if existing.devIf == devIf {
+			inv.lock.Unlock()
+			return
+		}
+		inv.removeItem(existing)
+	}
+	inv.items[devIf.key()] = item
+	addIndex(inv.byPath, devIf.Path, item)
+	addIndex(inv.byPath, devIf.Device.Path, item)
+	addIndex(inv.byDevpath, devIf.key(), item)
+	addIndex(inv.byDevpath, devIf.Device.devpath(), item)
+	addIndex(inv.byVidPid, [2]int{item.vendorId, item.productId}, item)
+	if item.serial != "" {
+		addIndex(inv.bySerial, item.serial, item)
+	}
+	if item.portPath != "" {
+		addIndex(inv.byPortPath, item.portPath, item)
+	}
+	inv.notify(InventoryChange{Arrived: true, Interface: devIf})
+	inv.lock.Unlock()
+
+	devIf.WatchRemoval(func() { inv.remove(devIf) })
+}
+
+// Remove removes an interface from the Inventory, if it is there.
+func (inv *Inventory) Remove(devIf *DeviceInterface) {
+	inv.remove(devIf)
+}
+
+// remove removes an interface unless it has been replaced by another report
+// of the same interface.
+func (inv *Inventory) remove(devIf *DeviceInterface) {
+	inv.lock.Lock()
+	defer inv.lock.Unlock()
+
+	item := inv.items[devIf.key()]
+	if item == nil || item.devIf != devIf {
+		return
+	}
+
+	inv.removeItem(item)
+}
+
+// removeItem removes an item from the Inventory. It must be called with the
+// lock held.
+func (inv *Inventory) removeItem(item *inventoryItem) {
+	devIf := item.devIf
+	delete(inv.items, devIf.key())
+	removeIndex(inv.byPath, devIf.Path, item)
+	removeIndex(inv.byPath, devIf.Device.Path, item)
+	removeIndex(inv.byDevpath, devIf.key(), item)
+	removeIndex(inv.byDevpath, devIf.Device.devpath(), item)
+	removeIndex(inv.byVidPid, [2]int{item.vendorId, item.productId}, item)
+	removeIndex(inv.bySerial, item.serial, item)
+	removeIndex(inv.byPortPath, item.portPath, item)
+	inv.notify(InventoryChange{Arrived: false, Interface: devIf})
+}
+
+func addIndex[K comparable](index map[K]map[*inventoryItem]bool, key K, item *inventoryItem) {
+	set := index[key]
+	if set == nil {
+		set = make(map[*inventoryItem]bool)
+		index[key] = set
+	}
+	set[item] = true
+}
+
+func removeIndex[K comparable](index map[K]map[*inventoryItem]bool, key K, item *inventoryItem) {
+	set := index[key]
+	delete(set, item)
+	if len(set) == 0 {
+		delete(index, key)
+	}
+}
+
+// sortedInterfaces lists the interfaces in a set of items in topology order.
+func sortedInterfaces(items map[*inventoryItem]bool) []*DeviceInterface {
+	devIfs := make([]*DeviceInterface, 0, len(items))
+	for item := range items {
+		devIfs = append(devIfs, item.devIf)
+	}
+
+	sortInterfaces(devIfs)
+	return devIfs
+}
+
+// Interfaces lists all of the interfaces in the Inventory in topology order,
+// as described for List.
+func (inv *Inventory) Interfaces() []*DeviceInterface {
+	inv.lock.RLock()
+	defer inv.lock.RUnlock()
+
+	return inv.snapshot()
+}
+
+func (inv *Inventory) snapshot() []*DeviceInterface {
+	devIfs := make([]*DeviceInterface, 0, len(inv.items))
+	for _, item := range inv.items {
+		devIfs = append(devIfs, item.devIf)
+	}
+
+	sortInterfaces(devIfs)
+	return devIfs
+}
+
+// Devices lists the devices which provide the interfaces in the Inventory
+// in topology order, without duplicates.
+func (inv *Inventory) Devices() []*Device {
+	inv.lock.RLock()
+	defer inv.lock.RUnlock()
+
+	seen := make(map[string]bool)
+	var devices []*Device
+	for _, item := range inv.items {
+		if !seen[item.devIf.Device.Path] {
+			seen[item.devIf.Device.Path] = true
+			devices = append(devices, item.devIf.Device)
+		}
+	}
+
+	sortDevices(devices)
+	return devices
+}
+
+// ByPath finds the interfaces whose own Path or whose Device's Path is the
+// given path.
+func (inv *Inventory) ByPath(path string) []*DeviceInterface {
+	inv.lock.RLock()
+	defer inv.lock.RUnlock()
+
+	return sortedInterfaces(inv.byPath[path])
+}
+
+// ByDevpath finds the interfaces whose own devpath or whose Device's devpath
+// is the given devpath. On Linux a devpath is the path of a device in sysfs
+// without the /sys prefix, as in udev's DEVPATH property. On Windows there
+// are no devpaths, so the Paths of the interface and device are used.
+func (inv *Inventory) ByDevpath(devpath string) []*DeviceInterface {
+	inv.lock.RLock()
+	defer inv.lock.RUnlock()
+
+	return sortedInterfaces(inv.byDevpath[devpath])
+}
+
+// ByVendorProduct finds the interfaces of the USB devices with the given
+// vendor and product IDs.
+func (inv *Inventory) ByVendorProduct(vendorId int, productId int) []*DeviceInterface {
+	inv.lock.RLock()
+	defer inv.lock.RUnlock()
+
+	return sortedInterfaces(inv.byVidPid[[2]int{vendorId, productId}])
+}
+
+// BySerial finds the interfaces of the USB devices with the given serial
+// number.
+func (inv *Inventory) BySerial(serial string) []*DeviceInterface {
+	inv.lock.RLock()
+	defer inv.lock.RUnlock()
+
+	return sortedInterfaces(inv.bySerial[serial])
+}
+
+// ByPortPath finds the interfaces of the USB devices connected through the
+// port with the given path, as returned by Device.PortPath.
+func (inv *Inventory) ByPortPath(portPath string) []*DeviceInterface {
+	inv.lock.RLock()
+	defer inv.lock.RUnlock()
+
+	return sortedInterfaces(inv.byPortPath[portPath])
+}
+
+// Select finds the interfaces which the filter selects, in topology order.
+func (inv *Inventory) Select(filter Filter) []*DeviceInterface {
+	inv.lock.RLock()
+	defer inv.lock.RUnlock()
+
+	var devIfs []*DeviceInterface
+	for _, item := range inv.items {
+		if filter.Matches(item.devIf) {
+			devIfs = append(devIfs, item.devIf)
+		}
+	}
+
+	sortInterfaces(devIfs)
+	return devIfs
+}
+
+// Subscribe returns the interfaces currently in the Inventory along with a
+// channel which receives every subsequent change, so that nothing is missed
+// or seen twice. Changes are queued for as long as necessary rather than
+// holding up the Listener.
+//
+// Call the returned cancel function to stop receiving changes, after which
+// the channel is closed.
+func (inv *Inventory) Subscribe() (
+	snapshot []*DeviceInterface,
+	changes <-chan InventoryChange,
+	cancel func(),
+) {
+	sub := &inventorySubscriber{
+		wake: make(chan struct{}, 1),
+		out:  make(chan InventoryChange),
+		done: make(chan struct{}),
+	}
+
+	inv.lock.Lock()
+	snapshot = inv.snapshot()
+	inv.subscribers[sub] = true
+	inv.lock.Unlock()
+
+	go sub.run()
+
+	var once sync.Once
+	cancel = func() {
+		once.Do(func() {
+			inv.lock.Lock()
+			delete(inv.subscribers, sub)
+			inv.lock.Unlock()
+			close(sub.done)
+		})
+	}
+
+	return snapshot, sub.out, cancel
+}
+
+// notify queues a change for each subscriber. It must be called with the
+// lock held so that changes are queued in the order they are made.
+func (inv *Inventory) notify(change InventoryChange) {
+	for sub := range inv.subscribers {
+		sub.push(change)
+	}
+}
+
+// inventorySubscriber queues changes for a subscriber without limit.
+type inventorySubscriber struct {
+	lock    sync.Mutex
+	pending []InventoryChange
+	wake    chan struct{}
+	out     chan InventoryChange
+	done    chan struct{}
+}
+
+func (sub *inventorySubscriber) push(change InventoryChange) {
+	sub.lock.Lock()
+	sub.pending = append(sub.pending, change)
+	sub.lock.Unlock()
+
+	select {
+	case sub.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (sub *inventorySubscriber) run() {
+	defer close(sub.out)
+
+	for {
+		sub.lock.Lock()
+		pending := sub.pending
+		sub.pending = nil
+		sub.lock.Unlock()
+
+		if len(pending) == 0 {
+			select {
+			case <-sub.wake:
+				continue
+			case <-sub.done:
+				return
+			}
+		}
+
+		for _, change := range pending {
+			select {
+			case sub.out <- change:
+			case <-sub.done:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+//go:build linux
+
+package hotplug
+
+import (
+	"testing"
+	"time"
+)
+
+// expectChange checks the next change an Inventory subscription receives.
+func expectChange(t *testing.T, changes <-chan InventoryChange, arrived bool, path string) *DeviceInterface {
+	t.Helper()
+
+	select {
+	case change := <-changes:
+		if change.Arrived != arrived || change.Interface.Path != path {
+			t.Fatalf("got change %t %s, want %t %s",
+				change.Arrived, change.Interface.Path, arrived, path)
+		}
+		return change.Interface
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for change %t %s", arrived, path)
+		return nil
+	}
+}
+
+func TestInventoryQueries(t *testing.T) {
+	inv := NewInventory()
+	l, err := New(DevIfHid, inv.Add, FromCapture(loadCapture(t, "hidraw.db", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = l.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Stop()
+
+	filter, err := ParseFilter(`usb.serial == "ABC123"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name   string
+		devIfs []*DeviceInterface
+		want   int
+	}{
+		{"Interfaces", inv.Interfaces(), 1},
+		{"ByPath interface", inv.ByPath("/dev/hidraw0"), 1},
+		{"ByPath device", inv.ByPath("/sys/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.0/0003:046D:C52B.0001"), 1},
+		{"ByDevpath", inv.ByDevpath(testHidraw0), 1},
+		{"ByVendorProduct", inv.ByVendorProduct(0x046d, 0xc52b), 1},
+		{"ByVendorProduct other", inv.ByVendorProduct(0x046d, 0xc52c), 0},
+		{"BySerial", inv.BySerial("ABC123"), 1},
+		{"ByPortPath", inv.ByPortPath("1-2"), 1},
+		{"ByPortPath other", inv.ByPortPath("1-3"), 0},
+		{"Select", inv.Select(filter), 1},
+	} {
+		if len(test.devIfs) != test.want {
+			t.Errorf("%s: got %d interfaces, want %d", test.name, len(test.devIfs), test.want)
+		}
+	}
+
+	if devices := inv.Devices(); len(devices) != 1 || !devices[0].Is(DevHid) {
+		t.Errorf("got devices %v, want the HID device", devices)
+	}
+}
+
+func TestInventoryEnumerateReplaces(t *testing.T) {
+	inv := NewInventory()
+	l, err := New(DevIfHid, inv.Add, FromCapture(loadCapture(t, "hidraw.db", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = l.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Stop()
+
+	snapshot, changes, cancel := inv.Subscribe()
+	defer cancel()
+	if len(snapshot) != 1 {
+		t.Fatalf("got %d interfaces, want 1", len(snapshot))
+	}
+
+	// reporting the interface again replaces it rather than adding it twice
+	err = l.Enumerate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectChange(t, changes, false, "/dev/hidraw0")
+	replacement := expectChange(t, changes, true, "/dev/hidraw0")
+	if replacement == snapshot[0] {
+		t.Error("entry wasn't replaced by the new report")
+	}
+	if devIfs := inv.ByPath("/dev/hidraw0"); len(devIfs) != 1 || devIfs[0] != replacement {
+		t.Errorf("got %v by path, want only the replacement", devIfs)
+	}
+
+	// stopping the Listener removes the interface once, even though both
+	// reports of it are cancelled
+	l.Stop()
+	expectChange(t, changes, false, "/dev/hidraw0")
+	if n := len(inv.Interfaces()); n != 0 {
+		t.Errorf("got %d interfaces after Stop, want 0", n)
+	}
+
+	select {
+	case change := <-changes:
+		t.Errorf("got unexpected change %t %s", change.Arrived, change.Interface.Path)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestInventoryFollowsEvents(t *testing.T) {
+	inv := NewInventory()
+	_, changes, cancel := inv.Subscribe()
+	defer cancel()
+
+	l, err := New(DevIfHid, inv.Add, FromCapture(loadCapture(t, "hidraw.db", "hidraw.events")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = l.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Stop()
+
+	expectChange(t, changes, true, "/dev/hidraw0")
+	expectChange(t, changes, true, "/dev/hidraw1")
+	expectChange(t, changes, false, "/dev/hidraw0")
+	expectChange(t, changes, false, "/dev/hidraw1")
+
+	if n := len(inv.Interfaces()); n != 0 {
+		t.Errorf("got %d interfaces, want 0", n)
+	}
+}
+
+func TestInventoryKeepsListedInterfaces(t *testing.T) {
+	devIfs, err := List(DevIfHid, nil, FromCapture(loadCapture(t, "hidraw.db", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inv := NewInventory()
+	for _, devIf := range devIfs {
+		inv.Add(devIf)
+	}
+
+	// the removal of listed interfaces can't be detected, so they stay
+	// until they are removed by hand
+	time.Sleep(10 * time.Millisecond)
+	if n := len(inv.Interfaces()); n != 1 {
+		t.Fatalf("got %d interfaces, want 1", n)
+	}
+
+	inv.Remove(devIfs[0])
+	if n := len(inv.Interfaces()); n != 0 {
+		t.Errorf("got %d interfaces after Remove, want 0", n)
+	}
+}
@@ -0,0 +1,158 @@
+package hotplug
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrNotFound is returned by Find when no interface matches.
+var ErrNotFound = errors.New("no matching device interface found")
+
+// List returns the interfaces of the given class which are present and
+// match the filter, in topology order. The options are passed to New.
+//
+// The interfaces are sorted by the Path of their Device and then by their
+// own Path, comparing runs of digits by their numeric value so that, for
+// example, devices on USB port 10 come after those on port 9.
+//
+// Removals of the interfaces aren't watched, so their contexts are already
+// cancelled, with the cause ErrStopped.
+func List(
+	class InterfaceClass,
+	filter Filter,
+	options ...Option,
+) ([]*DeviceInterface, error) {
+	var devIfs []*DeviceInterface
+
+	// callbacks must run before Enumerate returns
+	options = append(options, DispatchSerial())
+
+	l, err := New(class, func(devIf *DeviceInterface) {
+		if filter.Matches(devIf) {
+			devIfs = append(devIfs, devIf)
+		}
+	}, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.Enumerate()
+	if err != nil {
+		return nil, err
+	}
+
+	// nothing watches for removals, so release the interfaces, which
+	// cancels their contexts
+	l.Stop()
+
+	sortInterfaces(devIfs)
+	return devIfs, nil
+}
+
+// ListDevices returns the devices which provide the interfaces List would
+// return, in the same order and without duplicates.
+func ListDevices(
+	class InterfaceClass,
+	filter Filter,
+	options ...Option,
+) ([]*Device, error) {
+	devIfs, err := List(class, filter, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []*Device
+	seen := make(map[string]bool)
+	for _, devIf := range devIfs {
+		if !seen[devIf.Device.Path] {
+			seen[devIf.Device.Path] = true
+			devices = append(devices, devIf.Device)
+		}
+	}
+
+	return devices, nil
+}
+
+// Find returns the first interface List would return, or ErrNotFound if
+// there are none.
+func Find(
+	class InterfaceClass,
+	filter Filter,
+	options ...Option,
+) (*DeviceInterface, error) {
+	devIfs, err := List(class, filter, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(devIfs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return devIfs[0], nil
+}
+
+// sortInterfaces sorts interfaces in topology order.
+func sortInterfaces(devIfs []*DeviceInterface) {
+	sort.SliceStable(devIfs, func(i, j int) bool {
+		a, b := devIfs[i], devIfs[j]
+		if order := comparePaths(a.Device.Path, b.Device.Path); order != 0 {
+			return order < 0
+		}
+		return comparePaths(a.Path, b.Path) < 0
+	})
+}
+
+// sortDevices sorts devices in topology order.
+func sortDevices(devices []*Device) {
+	sort.SliceStable(devices, func(i, j int) bool {
+		return comparePaths(devices[i].Path, devices[j].Path) < 0
+	})
+}
+
+// comparePaths compares two paths, treating runs of digits as numbers.
+func comparePaths(a string, b string) int {
+	for len(a) > 0 && len(b) > 0 {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			aEnd, bEnd := digitsEnd(a), digitsEnd(b)
+			aNum, bNum := trimZeros(a[:aEnd]), trimZeros(b[:bEnd])
+			if len(aNum) != len(bNum) {
+				return len(aNum) - len(bNum)
+			}
+			if aNum != bNum {
+				if aNum < bNum {
+					return -1
+				}
+				return 1
+			}
+			a, b = a[aEnd:], b[bEnd:]
+			continue
+		}
+
+		if a[0] != b[0] {
+			return int(a[0]) - int(b[0])
+		}
+		a, b = a[1:], b[1:]
+	}
+
+	return len(a) - len(b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func digitsEnd(s string) int {
+	end := 0
+	for end < len(s) && isDigit(s[end]) {
+		end++
+	}
+	return end
+}
+
+func trimZeros(s string) string {
+	for len(s) > 1 && s[0] == '0' {
+		s = s[1:]
+	}
+	return s
+}
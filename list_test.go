@@ -0,0 +1,36 @@
+package hotplug
+
+import (
+	"testing"
+)
+
+func TestComparePaths(t *testing.T) {
+	for _, test := range []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{"/dev/hidraw2", "/dev/hidraw10", -1},
+		{"/dev/hidraw10", "/dev/hidraw2", 1},
+		{"/dev/hidraw2", "/dev/hidraw2", 0},
+		{"/dev/hidraw02", "/dev/hidraw2", 0},
+		{"1-2.9", "1-2.10", -1},
+		{"1-2", "1-2.1", -1},
+		{"/dev/ttyACM0", "/dev/ttyUSB0", -1},
+		{"", "a", -1},
+	} {
+		got := comparePaths(test.a, test.b)
+		if sign(got) != test.want {
+			t.Errorf("comparePaths(%q, %q) = %d, want sign %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func sign(n int) int {
+	if n < 0 {
+		return -1
+	} else if n > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,107 @@
+//go:build linux
+
+package hotplug
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// hidOnPorts builds a capture with a HID device on each of the given ports
+// of the first root hub, each with a hidraw node numbered in port order.
+func hidOnPorts(t *testing.T, ports ...string) *Capture {
+	t.Helper()
+
+	var db strings.Builder
+	for i, port := range ports {
+		usb := "/devices/pci0000:00/0000:00:14.0/usb1/" + port
+		hid := usb + "/" + port + ":1.0/0003:046D:C52B.000" + string(rune('1'+i))
+		hidraw := "hidraw" + string(rune('0'+i))
+		db.WriteString("P: " + usb + "\n" +
+			"E: SUBSYSTEM=usb\nE: DEVTYPE=usb_device\n" +
+			"E: ID_VENDOR_ID=046d\nE: ID_MODEL_ID=c52b\n\n" +
+			"P: " + usb + "/" + port + ":1.0\n" +
+			"E: SUBSYSTEM=usb\nE: DEVTYPE=usb_interface\n\n" +
+			"P: " + hid + "\nE: SUBSYSTEM=hid\n\n" +
+			"P: " + hid + "/hidraw/" + hidraw + "\nN: " + hidraw + "\nE: SUBSYSTEM=hidraw\n\n")
+	}
+
+	capture := &Capture{}
+	err := capture.ReadExportDB(strings.NewReader(db.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return capture
+}
+
+func TestListOrder(t *testing.T) {
+	capture := hidOnPorts(t, "1-10", "1-9", "1-2")
+
+	devIfs, err := List(DevIfHid, nil, FromCapture(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, devIf := range devIfs {
+		got = append(got, devIf.Path)
+	}
+
+	// numerically by port: 1-2, 1-9, 1-10
+	want := []string{"/dev/hidraw2", "/dev/hidraw1", "/dev/hidraw0"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	devices, err := ListDevices(DevIfHid, nil, FromCapture(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 3 || devices[0].Path != devIfs[0].Device.Path {
+		t.Errorf("got devices %v, want those of %v in the same order", devices, got)
+	}
+}
+
+func TestListFilter(t *testing.T) {
+	capture := hidOnPorts(t, "1-1", "1-2")
+
+	devIfs, err := List(DevIfHid, MatchPortPath("1-2"), FromCapture(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devIfs) != 1 || devIfs[0].Path != "/dev/hidraw1" {
+		t.Errorf("got %v, want only hidraw1", devIfs)
+	}
+}
+
+func TestFind(t *testing.T) {
+	capture := hidOnPorts(t, "1-2", "1-1")
+
+	devIf, err := Find(DevIfHid, nil, FromCapture(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if devIf.Path != "/dev/hidraw1" {
+		t.Errorf("got %s, want the interface on port 1-1", devIf.Path)
+	}
+
+	_, err = Find(DevIfHid, MatchSerial("nothing"), FromCapture(capture))
+	if err != ErrNotFound {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestListCancelsContexts(t *testing.T) {
+	devIfs, err := List(DevIfHid, nil, FromCapture(loadCapture(t, "hidraw.db", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devIfs) != 1 {
+		t.Fatalf("got %d interfaces, want 1", len(devIfs))
+	}
+
+	if cause := context.Cause(devIfs[0].Context()); cause != ErrStopped {
+		t.Errorf("got cause %v, want ErrStopped", cause)
+	}
+}
@@ -1,35 +1,549 @@
 package hotplug
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
 type ListenerCallback func(iface *DeviceInterface)
 
+// ErrRemoved is the cause of the cancellation of a DeviceInterface's Context
+// when the interface was removed from the system.
+var ErrRemoved = errors.New("device interface was removed")
+
+// ErrOverflow is reported to the error handler when the platform dropped
+// events because they arrived faster than they could be received. The
+// Listener recovers by enumerating the present devices and reporting any
+// arrivals and removals it missed.
+var ErrOverflow = errors.New("device events were lost; resynchronising")
+
+// ErrStopped is the cause of the cancellation of a DeviceInterface's Context
+// when the Listener which reported it was stopped.
+var ErrStopped = errors.New("listener was stopped")
+
+// A PanicError reports a panic in a callback. The Listener recovers from such
+// panics and carries on delivering events.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in hotplug callback: %v", e.Value)
+}
+
+// An Option configures optional behaviour of a Listener.
+type Option func(l *Listener) error
+
+// OnError sets a function to be called with each error the Listener
+// encounters while running, including panics in callbacks and failures of
+// the platform's event monitor. It is called from the goroutine on which the
+// error occurred.
+func OnError(handler func(err error)) Option {
+	return func(l *Listener) error {
+		l.errHandler = handler
+		return nil
+	}
+}
+
+// ReceiveBufferSize sets the size in bytes of the buffer in which the
+// operating system holds events until the Listener receives them. A larger
+// buffer makes overflows during bursts of events less likely.
+//
+// It only has an effect on Linux, where sizes above the system limit
+// require the CAP_NET_ADMIN capability.
+func ReceiveBufferSize(bytes int) Option {
+	return func(l *Listener) error {
+		if bytes < 0 {
+			return errors.New("receive buffer size must not be negative")
+		}
+
+		l.receiveBufferSize = bytes
+		return nil
+	}
+}
+
+// AutoRestart makes the Listener recreate the platform's event monitor after
+// the given delay if it fails, rather than stopping listening. Once the
+// monitor has been recreated the Listener resynchronises as it does after
+// an overflow.
+func AutoRestart(delay time.Duration) Option {
+	return func(l *Listener) error {
+		l.autoRestart = true
+		l.restartDelay = delay
+		return nil
+	}
+}
+
+// WithFilter makes the Listener report only the interfaces which the filter
+// selects, such as one made by ParseFilter. Interfaces which aren't reported
+// on arrival aren't reported on removal either.
+func WithFilter(filter Filter) Option {
+	return func(l *Listener) error {
+		l.filter = filter
+		return nil
+	}
+}
+
+// A Listener reports the arrival and removal of device interfaces of a class.
+//
+// A Listener is safe for concurrent use by multiple goroutines.
 type Listener struct {
-	class     InterfaceClass
-	callback  ListenerCallback
+	class      InterfaceClass
+	callback   ListenerCallback
+	capture    *Capture
+	filter     Filter
+	dispatcher dispatcher
+
+	errHandler        func(err error)
+	autoRestart       bool
+	restartDelay      time.Duration
+	receiveBufferSize int
+	ready             *ReadyPolicy
+
+	// runLock serializes starting and stopping the platform listener
+	runLock sync.Mutex
+
+	// lock protects the fields below
+	lock     sync.Mutex
+	detachCb map[string][]func()
+	err      error
+
+	// listening is only changed with the runLock held as well, so either
+	// lock may be held to read it
 	listening bool
+
+	// ctx is the parent of the contexts of reported interfaces
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	// halt is closed when Stop begins, to abandon arrivals which are
+	// waiting to become ready
+	halt chan struct{}
+
+	// present and seqnums track the interfaces reported as arrived
+	present map[string]bool
+	seqnums map[string]uint64
+
+	// these implement Start
+	buffering bool
+	buffered  []*listenerEvent
+	dedupe    bool
+
 	platformListener
 }
 
+// listenerEvent is an arrival or removal on its way to the callbacks.
+type listenerEvent struct {
+	// devIf is the arriving interface, or nil for a removal
+	devIf *DeviceInterface
+
+	// key identifies the interface across arrival and removal
+	key string
+
+	// seqnum orders events for the same interface, or is zero if unknown
+	seqnum uint64
+
+	// below makes the event a removal of every interface whose key is a
+	// path below the key of the event, which is that of a removed ancestor
+	below bool
+	// repeat makes an arrival be reported even if the interface has already
+	// been reported, as Enumerate does
+	repeat bool
+}
+
 func New(
 	class InterfaceClass,
 	callback ListenerCallback,
+	options ...Option,
 ) (*Listener, error) {
 	l := &Listener{
-		class:    class,
-		callback: callback,
+		class:      class,
+		callback:   callback,
+		dispatcher: serialDispatcher{},
+		detachCb:   make(map[string][]func()),
+		present:    make(map[string]bool),
+		seqnums:    make(map[string]uint64),
+		halt:       make(chan struct{}),
+	}
+	l.ctx, l.cancel = context.WithCancelCause(context.Background())
+
+	for _, option := range options {
+		err := option(l)
+		if err != nil {
+			return l, err
+		}
 	}
+
 	return l, l.init()
 }
 
 // Listen calls the ArriveCallback each time a device is connected.
 func (l *Listener) Listen() error {
-	return l.listen()
+	l.runLock.Lock()
+	defer l.runLock.Unlock()
+
+	err := l.listen()
+	l.setListening(err == nil)
+	return err
+}
+
+// setListening records whether the Listener is listening. It must be called
+// with the runLock held.
+func (l *Listener) setListening(listening bool) {
+	l.lock.Lock()
+	l.listening = listening
+	l.lock.Unlock()
+}
+
+// Start calls the ArriveCallback for each device present in the system and
+// then each time a device is connected, like Listen followed by Enumerate,
+// but without races between the two.
+//
+// Events which occur during enumeration are held until it completes and are
+// then reconciled with its results, so that each device is reported exactly
+// once and detach callbacks only run for devices which were reported.
+func (l *Listener) Start() error {
+	l.lock.Lock()
+	l.buffering = true
+	l.dedupe = true
+	l.lock.Unlock()
+
+	l.runLock.Lock()
+	err := l.listen()
+	l.setListening(err == nil)
+	l.runLock.Unlock()
+	if err != nil {
+		l.lock.Lock()
+		l.buffering = false
+		l.dedupe = false
+		l.buffered = nil
+		l.lock.Unlock()
+		return err
+	}
+
+	enumErr := l.enumerate(false)
+
+	// events may still be arriving while we drain the buffer, so keep
+	// buffering until it has been emptied
+	for {
+		l.lock.Lock()
+		buffered := l.buffered
+		l.buffered = nil
+		if len(buffered) == 0 {
+			l.buffering = false
+		}
+		l.lock.Unlock()
+
+		if len(buffered) == 0 {
+			break
+		}
+
+		for _, evt := range buffered {
+			l.dispatch(evt)
+		}
+	}
+
+	return enumErr
 }
 
+// Stop stops listening for events. It waits for any callbacks which are
+// running or queued to finish, so it must not be called from a callback.
+//
+// The contexts of the interfaces the Listener reported are cancelled, even if
+// it wasn't listening and they were reported by Enumerate, in which case the
+// error saying so is still returned.
 func (l *Listener) Stop() error {
-	return l.stop()
+	l.runLock.Lock()
+	wasListening := l.listening
+	err := l.stop()
+	l.setListening(false)
+	l.runLock.Unlock()
+	if err != nil && wasListening {
+		return err
+	}
+
+	l.lock.Lock()
+	close(l.halt)
+	l.lock.Unlock()
+
+	l.dispatcher.wait()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.halt = make(chan struct{})
+
+	// removals can't be seen while stopped, so forget what was present
+	l.dedupe = false
+	l.present = make(map[string]bool)
+	l.seqnums = make(map[string]uint64)
+
+	l.cancel(ErrStopped)
+	l.ctx, l.cancel = context.WithCancelCause(context.Background())
+
+	return err
+}
+
+// Err returns the most recent error the Listener encountered while running,
+// or nil if there has been none.
+func (l *Listener) Err() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.err
 }
 
-// Enumerate calls the ArriveCallback for each device present in the system.
+// report records an error and passes it to the error handler.
+func (l *Listener) report(err error) {
+	l.lock.Lock()
+	l.err = err
+	l.lock.Unlock()
+
+	if l.errHandler != nil {
+		l.errHandler(err)
+	}
+}
+
+// fail is called by the platform when its event monitor has stopped because
+// of an error.
+func (l *Listener) fail(err error) {
+	l.report(err)
+
+	if l.autoRestart {
+		go l.restart()
+	}
+}
+
+// restart recreates a failed event monitor, retrying until it succeeds or
+// the Listener is stopped.
+func (l *Listener) restart() {
+	for {
+		time.Sleep(l.restartDelay)
+
+		l.runLock.Lock()
+		if !l.listening {
+			l.runLock.Unlock()
+			return
+		}
+
+		// release the failed monitor, which has already reported its error,
+		// or do nothing if a previous attempt left none
+		l.stop()
+		err := l.listen()
+		l.runLock.Unlock()
+
+		if err == nil {
+			l.resync()
+			return
+		}
+
+		l.report(fmt.Errorf("failed to restart listener: %w", err))
+	}
+}
+
+// overflow is called by the platform when events have been lost.
+func (l *Listener) overflow() {
+	l.report(ErrOverflow)
+	l.resync()
+}
+
+// resync compares the interfaces which are present with those which have
+// been reported and delivers arrivals and removals for the differences.
+func (l *Listener) resync() {
+	devIfs, err := l.scan()
+	if err != nil {
+		l.report(fmt.Errorf("failed to resynchronise: %w", err))
+		return
+	}
+
+	found := make(map[string]*DeviceInterface)
+	for _, devIf := range devIfs {
+		found[devIf.key()] = devIf
+	}
+
+	l.lock.Lock()
+	var events []*listenerEvent
+	for key := range l.present {
+		if found[key] == nil {
+			events = append(events, &listenerEvent{key: key})
+		}
+	}
+	for key, devIf := range found {
+		if !l.present[key] {
+			events = append(events, &listenerEvent{devIf: devIf, key: key})
+		}
+	}
+	l.lock.Unlock()
+
+	for _, evt := range events {
+		l.deliver(evt)
+	}
+}
+
+// protect runs a callback, recovering from and reporting any panic.
+func (l *Listener) protect(fn func()) {
+	defer func() {
+		if value := recover(); value != nil {
+			l.report(&PanicError{Value: value, Stack: debug.Stack()})
+		}
+	}()
+
+	fn()
+}
+
+// Enumerate calls the ArriveCallback for each device present in the system,
+// including those which have already been reported.
+//
+// Unless the Listener uses DispatchSerial, the callbacks may still be running
+// when Enumerate returns.
 func (l *Listener) Enumerate() error {
-	return l.enumerate()
+	return l.enumerate(true)
+}
+
+// enumerate dispatches an arrival for each interface present. If repeat is
+// false, interfaces which have already been reported are skipped when
+// started with Start.
+func (l *Listener) enumerate(repeat bool) error {
+	devIfs, err := l.scan()
+	if err != nil {
+		return err
+	}
+
+	for _, devIf := range devIfs {
+		l.dispatch(&listenerEvent{devIf: devIf, key: devIf.key(), repeat: repeat})
+	}
+
+	return nil
+}
+
+// deliver handles an event received from the platform's monitor.
+func (l *Listener) deliver(evt *listenerEvent) {
+	l.lock.Lock()
+	if l.buffering {
+		l.buffered = append(l.buffered, evt)
+		l.lock.Unlock()
+		return
+	}
+	l.lock.Unlock()
+
+	l.dispatch(evt)
+}
+
+// dispatch hands the callbacks for an event to the dispatcher.
+func (l *Listener) dispatch(evt *listenerEvent) {
+	if evt.below {
+		for _, key := range l.presentBelow(evt.key) {
+			l.dispatch(&listenerEvent{key: key})
+		}
+		return
+	}
+
+	l.lock.Lock()
+	if !l.accept(evt) {
+		l.lock.Unlock()
+		return
+	}
+
+	if evt.devIf != nil {
+		var cancel context.CancelCauseFunc
+		evt.devIf.ctx, cancel = context.WithCancelCause(l.ctx)
+		evt.devIf.listener = l
+		evt.devIf.watched = l.listening
+		l.detachCb[evt.key] = append(l.detachCb[evt.key], func() {
+			cancel(ErrRemoved)
+		})
+	}
+	l.lock.Unlock()
+
+	if evt.devIf != nil {
+		devIf := evt.devIf
+		key := evt.key
+		l.dispatcher.submit(key, func() {
+			if l.ready != nil && !l.waitReady(devIf, key) {
+				return
+			}
+
+			l.setInArrive(devIf, true)
+			l.protect(func() { l.callback(devIf) })
+			l.setInArrive(devIf, false)
+		})
+		return
+	}
+
+	// the detach callbacks are looked up when the removal is run rather
+	// than now so that any registered by a queued arrival are included
+	key := evt.key
+	l.dispatcher.submit(key, func() {
+		l.lock.Lock()
+		callbacks := l.detachCb[key]
+		delete(l.detachCb, key)
+		l.lock.Unlock()
+
+		for _, callback := range callbacks {
+			if callback != nil {
+				l.protect(callback)
+			}
+		}
+	})
+}
+
+// setInArrive marks whether the arrive callback of an interface is running.
+func (l *Listener) setInArrive(devIf *DeviceInterface, inArrive bool) {
+	l.lock.Lock()
+	devIf.inArrive = inArrive
+	l.lock.Unlock()
+}
+
+// presentBelow returns the keys of the interfaces which have been reported as
+// arrived and whose keys are paths below a path.
+func (l *Listener) presentBelow(path string) []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	var keys []string
+	prefix := path + "/"
+	for key := range l.present {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// accept records an event in the set of present interfaces and reports
+// whether it should be dispatched, discarding arrivals which the filter
+// doesn't select, and stale and duplicate events when started with Start.
+// It must be called with the lock held.
+func (l *Listener) accept(evt *listenerEvent) bool {
+	if evt.devIf != nil && !l.filter.Matches(evt.devIf) {
+		return false
+	}
+
+	if evt.seqnum != 0 {
+		if l.dedupe && evt.seqnum <= l.seqnums[evt.key] {
+			return false
+		}
+		l.seqnums[evt.key] = evt.seqnum
+	}
+
+	wasPresent := l.present[evt.key]
+	if evt.devIf != nil {
+		l.present[evt.key] = true
+		return !l.dedupe || !wasPresent || evt.repeat
+	} else {
+		// devpaths are rarely reused, so don't keep the sequence numbers
+		// of removed interfaces around forever
+		delete(l.present, evt.key)
+		delete(l.seqnums, evt.key)
+		return !l.dedupe || wasPresent
+	}
 }
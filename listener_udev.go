@@ -4,26 +4,17 @@ package hotplug
 
 import (
 	"errors"
-	"golang.org/x/sys/unix"
-	"runtime"
-	"syscall"
 )
 
-/*
-	#cgo pkg-config: libudev
-	#include <libudev.h>
-	#include <string.h>
-*/
-import "C"
+// ancestorCondition selects the devices whose removals are watched as well as
+// those of the interfaces themselves, since interfaces are usually provided
+// by USB devices and the hubs they're plugged into.
+var ancestorCondition = &deviceCondition{subsystem: "usb"}
 
 type platformListener struct {
-	condition *deviceCondition
-	udev      *C.struct_udev
-	monitor   *C.struct_udev_monitor
-	closeChan chan interface{}
-	closePipe []int
-	deviceFd  int
-	detachCb  map[string][]func()
+	condition   *deviceCondition
+	source      deviceSource
+	stopMonitor func() error
 }
 
 func (l *Listener) init() error {
@@ -32,275 +23,124 @@ func (l *Listener) init() error {
 		return errors.New("unsupported InterfaceClass")
 	}
 
-	l.udev = C.udev_new()
-	if l.udev == nil {
-		return errors.New("failed to create udev context")
+	if l.capture != nil {
+		l.source = newCaptureSource(l.capture)
+	} else {
+		source, err := newUdevSource()
+		if err != nil {
+			return err
+		}
+		l.source = source
 	}
 
-	runtime.SetFinalizer(l, freeListener)
-
-	l.detachCb = make(map[string][]func())
-
 	return nil
 }
 
-func freeListener(l *Listener) {
-	C.udev_unref(l.udev)
-	l.udev = nil
-}
-
-func (l *Listener) listen() (err error) {
-	var flags int
-
-	if l.monitor != nil {
+func (l *Listener) listen() error {
+	if l.stopMonitor != nil {
 		return errors.New("listener is already listening")
 	}
 
-	l.monitor = C.udev_monitor_new_from_netlink(l.udev, C.CString("udev"))
-	if l.monitor == nil {
-		return errors.New("failed to create udev monitor")
-	}
-
-	res := C.udev_monitor_filter_add_match_subsystem_devtype(
-		l.monitor,
-		l.condition.subsystem,
-		l.condition.devtype,
-	)
-	if res < 0 {
-		err = errors.New("failed to add udev filter")
-		goto fail
-	}
-
-	res = C.udev_monitor_enable_receiving(l.monitor)
-	if res < 0 {
-		err = errors.New("failed to enable udev monitor")
-		goto fail
-	}
-
-	l.deviceFd = (int)(C.udev_monitor_get_fd(l.monitor))
-	if l.deviceFd < 0 {
-		err = errors.New("failed to get udev monitor fd")
-		goto fail
-	}
-
-	// ensure the file descriptor is close-on-exec
-	flags, err = unix.FcntlInt((uintptr)(l.deviceFd), unix.F_GETFD, 0)
-	if err != nil {
-		goto fail
-	}
-	if flags&unix.FD_CLOEXEC != 0 {
-		_, err = unix.FcntlInt((uintptr)(l.deviceFd), unix.F_SETFD, flags|unix.FD_CLOEXEC)
-		if err != nil {
-			goto fail
-		}
-	}
-
-	// ensure the file descriptor is non-blocking
-	// some older versions of udev are not by default
-	flags, err = unix.FcntlInt((uintptr)(l.deviceFd), unix.F_GETFL, 0)
+	conds := []*deviceCondition{l.condition, ancestorCondition}
+	stop, err := l.source.monitor(conds, l, l.receiveBufferSize)
 	if err != nil {
-		goto fail
-	}
-	if flags&unix.O_NONBLOCK == 0 {
-		_, err = unix.FcntlInt((uintptr)(l.deviceFd), unix.F_SETFL, flags|unix.O_NONBLOCK)
-		if err != nil {
-			goto fail
-		}
-	}
-
-	l.closePipe = make([]int, 2)
-	err = unix.Pipe(l.closePipe)
-	if err != nil {
-		goto fail
+		return err
 	}
 
-	l.closeChan = make(chan interface{})
-
-	go l.eventPump()
+	l.stopMonitor = stop
 	return nil
-
-fail:
-	C.udev_monitor_unref(l.monitor)
-	l.monitor = nil
-	l.deviceFd = -1
-	l.closeChan = nil
-	l.closePipe = nil
-	return
 }
 
 func (l *Listener) stop() error {
-	if l.monitor == nil {
+	if l.stopMonitor == nil {
 		return errors.New("listener is not listening")
 	}
 
-	// signal the eventPump thread to exit
-	err := unix.Close(l.closePipe[1])
+	err := l.stopMonitor()
 	if err != nil {
 		return err
 	}
 
-	// wait for the eventPump thread to exit
-	<-l.closeChan
-
-	l.closeChan = nil
-	l.closePipe = nil
-
-	C.udev_monitor_unref(l.monitor)
-	l.monitor = nil
-	l.deviceFd = -1
-
+	l.stopMonitor = nil
 	return nil
 }
 
-func (l *Listener) eventPump() {
-	fds := []unix.PollFd{
-		{Fd: (int32)(l.closePipe[0]), Events: unix.POLLHUP},
-		{Fd: (int32)(l.deviceFd), Events: unix.POLLIN},
-	}
-
-	for {
-		_, err := unix.Poll(fds, -1)
-		if err != nil {
-			if err.(syscall.Errno).Is(syscall.EINTR) {
-				continue
-			} else {
-				break
-			}
+func (l *Listener) handleEvent(dev sysDevice) {
+	switch dev.action() {
+	case "add":
+		devIf := l.newInterface(dev)
+		if devIf != nil {
+			l.deliver(&listenerEvent{
+				devIf:  devIf,
+				key:    devIf.key(),
+				seqnum: dev.seqnum(),
+			})
 		}
 
-		if fds[0].Revents != 0 {
-			break
+	case "remove":
+		devpath := dev.devpath()
+		if devpath == "" {
+			return
 		}
 
-		if fds[1].Revents != 0 {
-			dev := C.udev_monitor_receive_device(l.monitor)
-			if dev == nil {
-				continue
-			}
-
-			action := C.udev_device_get_action(dev)
-			if action != nil {
-				if C.strcmp(action, C.CString("add")) == 0 {
-					l.handleArrive(dev)
-				} else if C.strcmp(action, C.CString("remove")) == 0 {
-					l.handleRemove(dev)
-				}
-			}
-
-			C.udev_device_unref(dev)
+		if dev.subsystem() == l.condition.subsystem {
+			l.deliver(&listenerEvent{key: devpath, seqnum: dev.seqnum()})
 		}
-	}
-
-	close(l.closeChan)
-}
 
-func (l *Listener) enumerate() error {
-	enumerator := C.udev_enumerate_new(l.udev)
-	if nil == enumerator {
-		return errors.New("failed to create udev enumerator")
+		// the removal of an ancestor implies the removal of the interfaces
+		// below it, whose own removal events may have been lost or may
+		// arrive later
+		l.deliver(&listenerEvent{key: devpath, below: true})
 	}
-	defer C.udev_enumerate_unref(enumerator)
+}
 
-	res := C.udev_enumerate_add_match_subsystem(enumerator, l.condition.subsystem)
-	if res < 0 {
-		return errors.New("failed to add udev subsystem filter")
+func (l *Listener) scan() ([]*DeviceInterface, error) {
+	devices, err := l.source.enumerate(l.condition)
+	if err != nil {
+		return nil, err
 	}
 
-	if l.condition.devtype != nil {
-		res = C.udev_enumerate_add_match_property(
-			enumerator,
-			C.CString("DEVTYPE"),
-			l.condition.devtype,
-		)
-		if res < 0 {
-			return errors.New("failed to add udev devtype filter")
+	var devIfs []*DeviceInterface
+	for _, dev := range devices {
+		devIf := l.newInterface(dev)
+		if devIf != nil {
+			devIfs = append(devIfs, devIf)
 		}
 	}
 
-	res = C.udev_enumerate_scan_devices(enumerator)
-	if res < 0 {
-		return errors.New("failed to perform udev enumeration")
-	}
-
-	entry := C.udev_enumerate_get_list_entry(enumerator)
-	if entry == nil {
-		return errors.New("failed to get udev device list")
-	}
-
-	for {
-		path := C.udev_list_entry_get_name(entry)
-		if path == nil {
-			continue
-		}
-
-		dev := C.udev_device_new_from_syspath(l.udev, path)
-		if dev == nil {
-			continue
-		}
-
-		l.handleArrive(dev)
-		C.udev_device_unref(dev)
-
-		entry = C.udev_list_entry_get_next(entry)
-		if entry == nil {
-			break
-		}
-	}
-
-	return nil
+	return devIfs, nil
 }
 
-func (l *Listener) handleArrive(dev *C.struct_udev_device) {
+// newInterface creates a DeviceInterface for a sysfs device if it matches the
+// Listener's InterfaceClass.
+func (l *Listener) newInterface(dev sysDevice) *DeviceInterface {
 	if !l.condition.matches(dev) {
-		return
+		return nil
 	}
 
-	devnode := C.udev_device_get_devnode(dev)
-	if devnode == nil {
-		return
+	devnode := dev.devnode()
+	if devnode == "" {
+		return nil
 	}
-	goDevnode := C.GoString(devnode)
 
-	devpath := C.udev_device_get_devpath(dev)
-	if devpath == nil {
-		return
+	devpath := dev.devpath()
+	if devpath == "" {
+		return nil
 	}
-	goDevpath := C.GoString(devpath)
 
+	node := dev
 	if l.condition.interfaceOnly {
-		dev = C.udev_device_get_parent(dev)
+		dev = dev.parent()
 		if dev == nil {
-			return
+			return nil
 		}
 	}
 
 	goDevIf := &DeviceInterface{}
-	goDevIf.listener = l
-	goDevIf.Path = goDevnode
+	goDevIf.Path = devnode
 	goDevIf.Class = l.class
 	goDevIf.Device = newDevice(l, dev)
-	goDevIf.devpath = goDevpath
-	goDevIf.inArrive = true
-
-	l.callback(goDevIf)
-
-	goDevIf.inArrive = false
-}
-
-func (l *Listener) handleRemove(dev *C.struct_udev_device) {
-	devpath := C.udev_device_get_devpath(dev)
-	if devpath == nil {
-		return
-	}
-	goDevpath := C.GoString(devpath)
-
-	callbacks := l.detachCb[goDevpath]
-	if callbacks != nil {
-		for _, callback := range callbacks {
-			if callback != nil {
-				callback()
-			}
-		}
-		delete(l.detachCb, goDevpath)
-	}
+	goDevIf.devpath = devpath
+	goDevIf.sys = node
+	return goDevIf
 }
@@ -0,0 +1,328 @@
+//go:build linux
+
+package hotplug
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordEvents starts a Listener for hidraw interfaces and returns a channel
+// receiving "arrive PATH" and "remove PATH" as they are reported.
+func recordEvents(t *testing.T, capture *Capture) (*Listener, <-chan string) {
+	t.Helper()
+
+	events := make(chan string, 100)
+	l, err := New(DevIfHid, func(devIf *DeviceInterface) {
+		path := devIf.Path
+		events <- "arrive " + path
+		devIf.OnDetach(func() {
+			events <- "remove " + path
+		})
+	}, FromCapture(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = l.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Stop() })
+
+	return l, events
+}
+
+// expectEvents checks that the next events received are the given ones.
+func expectEvents(t *testing.T, events <-chan string, want ...string) {
+	t.Helper()
+
+	for _, expected := range want {
+		select {
+		case got := <-events:
+			if got != expected {
+				t.Fatalf("got %q, want %q", got, expected)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", expected)
+		}
+	}
+}
+
+func TestStartReportsEachInterfaceOnce(t *testing.T) {
+	// the events include an add of hidraw0, which is already in the
+	// database, and a late removal of hidraw0 after that of its interface
+	_, events := recordEvents(t, loadCapture(t, "hidraw.db", "hidraw.events"))
+
+	expectEvents(t, events,
+		"arrive /dev/hidraw0",
+		"arrive /dev/hidraw1",
+		"remove /dev/hidraw0",
+		"remove /dev/hidraw1",
+	)
+
+	select {
+	case got := <-events:
+		t.Errorf("got unexpected %q", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestEnumerateAfterStart(t *testing.T) {
+	l, events := recordEvents(t, loadCapture(t, "hidraw.db", ""))
+	expectEvents(t, events, "arrive /dev/hidraw0")
+
+	err := l.Enumerate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, events, "arrive /dev/hidraw0")
+}
+
+func TestStopCancelsEnumeratedInterfaces(t *testing.T) {
+	arrived := make(chan *DeviceInterface, 1)
+	l, err := New(DevIfHid, func(devIf *DeviceInterface) {
+		arrived <- devIf
+	}, FromCapture(loadCapture(t, "hidraw.db", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = l.Enumerate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	devIf := <-arrived
+
+	if devIf.Context().Err() != nil {
+		t.Fatal("context was cancelled before Stop")
+	}
+
+	// Stop still reports that the Listener wasn't listening
+	if l.Stop() == nil {
+		t.Error("Stop of a Listener which isn't listening succeeded")
+	}
+	if cause := context.Cause(devIf.Context()); cause != ErrStopped {
+		t.Errorf("got cause %v, want ErrStopped", cause)
+	}
+}
+
+func TestDispatchPoolDetach(t *testing.T) {
+	// WatchRemoval may be called from any goroutine, even while the arrive
+	// callback is finishing on one of the pool's workers
+	var watchers sync.WaitGroup
+	defer watchers.Wait()
+
+	events := make(chan string, 100)
+	l, err := New(DevIfHid, func(devIf *DeviceInterface) {
+		path := devIf.Path
+		watchers.Add(1)
+		go func() {
+			defer watchers.Done()
+			devIf.WatchRemoval(func() {})
+		}()
+
+		events <- "arrive " + path
+		devIf.OnDetach(func() {
+			events <- "remove " + path
+		})
+	}, FromCapture(loadCapture(t, "hidraw.db", "hidraw.events")), DispatchPool(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = l.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Stop()
+
+	// interfaces are dispatched in parallel, so only the order of the
+	// events of each one is known
+	got := make(map[string][]string)
+	for i := 0; i < 4; i++ {
+		select {
+		case evt := <-events:
+			path := evt[strings.Index(evt, " ")+1:]
+			got[path] = append(got[path], evt)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out; got %v", got)
+		}
+	}
+
+	for _, path := range []string{"/dev/hidraw0", "/dev/hidraw1"} {
+		if len(got[path]) != 2 || got[path][0] != "arrive "+path || got[path][1] != "remove "+path {
+			t.Errorf("got %v for %s, want an arrival then a removal", got[path], path)
+		}
+	}
+}
+
+func TestOverflowResynchronises(t *testing.T) {
+	errs := make(chan error, 10)
+	events := make(chan string, 100)
+	capture := loadCapture(t, "hidraw.db", "")
+	l, err := New(DevIfHid, func(devIf *DeviceInterface) {
+		path := devIf.Path
+		events <- "arrive " + path
+		devIf.OnDetach(func() {
+			events <- "remove " + path
+		})
+	}, FromCapture(capture), OnError(func(err error) { errs <- err }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = l.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Stop()
+	expectEvents(t, events, "arrive /dev/hidraw0")
+
+	// while the events are lost, hidraw0 is replaced by hidraw1
+	src := l.source.(*captureSource)
+	src.lock.Lock()
+	delete(src.devices, testHidraw0)
+	hidraw1 := newCapturedDevice("/devices/pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.0/0003:046D:C52B.0001/hidraw/hidraw1")
+	hidraw1.Properties["SUBSYSTEM"] = "hidraw"
+	hidraw1.Properties["DEVNAME"] = "/dev/hidraw1"
+	src.devices[hidraw1.Devpath] = hidraw1
+	src.lock.Unlock()
+
+	l.overflow()
+
+	select {
+	case err := <-errs:
+		if err != ErrOverflow {
+			t.Errorf("got error %v, want ErrOverflow", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("overflow wasn't reported")
+	}
+
+	// the order of the differences isn't defined
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case evt := <-events:
+			got[evt] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out; got %v", got)
+		}
+	}
+	if !got["remove /dev/hidraw0"] || !got["arrive /dev/hidraw1"] {
+		t.Errorf("got %v, want hidraw0 removed and hidraw1 arrived", got)
+	}
+
+	l.lock.Lock()
+	listening := l.listening
+	l.lock.Unlock()
+	if !listening {
+		t.Error("listener stopped listening after the overflow")
+	}
+}
+
+func TestWithFilter(t *testing.T) {
+	filter, err := ParseFilter("usb.vid == 0x1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan string, 100)
+	l, err := New(DevIfHid, func(devIf *DeviceInterface) {
+		path := devIf.Path
+		events <- "arrive " + path
+		devIf.OnDetach(func() {
+			events <- "remove " + path
+		})
+	}, FromCapture(loadCapture(t, "hidraw.db", "hidraw.events")), WithFilter(filter))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = l.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Stop()
+
+	expectEvents(t, events, "arrive /dev/hidraw1", "remove /dev/hidraw1")
+}
+
+func TestRemovalOfInterfaceBelowUsbInterface(t *testing.T) {
+	capture := loadCapture(t, "hidraw.db", "hidraw.events")
+
+	arrived := make(chan *DeviceInterface, 1)
+	detached := make(chan string, 10)
+	l, err := New(DevIfHid, func(devIf *DeviceInterface) {
+		path := devIf.Path
+		if path == "/dev/hidraw0" {
+			arrived <- devIf
+		}
+		devIf.OnDetach(func() {
+			detached <- path
+		})
+	}, FromCapture(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = l.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Stop()
+
+	var hidraw0 *DeviceInterface
+	select {
+	case hidraw0 = <-arrived:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for hidraw0")
+	}
+
+	// hidraw1 is removed last, so once it has gone every event has been
+	// handled
+	var removals []string
+	for len(removals) == 0 || removals[len(removals)-1] != "/dev/hidraw1" {
+		select {
+		case path := <-detached:
+			removals = append(removals, path)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for removals; got %v", removals)
+		}
+	}
+
+	if len(removals) != 2 || removals[0] != "/dev/hidraw0" {
+		t.Errorf("got removals %v, want hidraw0 once then hidraw1", removals)
+	}
+
+	select {
+	case <-hidraw0.Done():
+	default:
+		t.Fatal("hidraw0's context wasn't cancelled")
+	}
+	if cause := context.Cause(hidraw0.Context()); cause != ErrRemoved {
+		t.Errorf("got cause %v, want ErrRemoved", cause)
+	}
+}
+
+func TestRemovalOfInterfaceBelowUsbDevice(t *testing.T) {
+	capture := loadCapture(t, "hidraw.db", "")
+	err := capture.ReadMonitor(strings.NewReader(`UDEV  [1.0] remove   /devices/pci0000:00/0000:00:14.0/usb1/1-2 (usb)
+ACTION=remove
+DEVPATH=/devices/pci0000:00/0000:00:14.0/usb1/1-2
+SUBSYSTEM=usb
+DEVTYPE=usb_device
+SEQNUM=300
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the USB device's removal is reported, which removes hidraw0
+	_, events := recordEvents(t, capture)
+	expectEvents(t, events, "arrive /dev/hidraw0", "remove /dev/hidraw0")
+}
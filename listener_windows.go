@@ -26,10 +26,14 @@ type platformListener struct {
 	handle      cgo.Handle
 	notifHandle C.HCMNOTIFICATION
 	eventChan   chan interface{}
-	detachCb    map[string][]func()
+	pumpDone    chan interface{}
 }
 
 func (l *Listener) init() error {
+	if l.capture != nil {
+		return errors.New("captures are only supported with udev")
+	}
+
 	return nil
 }
 
@@ -40,7 +44,7 @@ func (l *Listener) listen() error {
 
 	l.handle = cgo.NewHandle(l)
 	l.eventChan = make(chan interface{}, 10)
-	l.detachCb = make(map[string][]func())
+	l.pumpDone = make(chan interface{})
 
 	go l.eventPump()
 
@@ -75,8 +79,8 @@ func (l *Listener) stop() (err error) {
 	}
 
 	l.notifHandle = nil
-	l.detachCb = nil
 	close(l.eventChan)
+	<-l.pumpDone
 	l.handle.Delete()
 	return
 }
@@ -133,18 +137,22 @@ func configNotificationHandler(
 }
 
 func (l *Listener) eventPump() {
-	for {
-		switch evt := (<-l.eventChan).(type) {
+	defer close(l.pumpDone)
+
+	for evt := range l.eventChan {
+		switch evt := evt.(type) {
 		case *attachEvent:
-			l.handleArrive(evt.devIf)
+			if l.prepareInterface(evt.devIf) {
+				l.deliver(&listenerEvent{devIf: evt.devIf, key: evt.devIf.key()})
+			}
 
 		case *detachEvent:
-			l.handleRemove(evt.devIfId)
+			l.deliver(&listenerEvent{key: evt.devIfId})
 		}
 	}
 }
 
-func (l *Listener) enumerate() error {
+func (l *Listener) scan() ([]*DeviceInterface, error) {
 	classGuid := interfaceClassToGuid[l.class]
 	var bufSize C.ULONG
 	var buf []uint16
@@ -159,7 +167,7 @@ func (l *Listener) enumerate() error {
 			C.CM_GET_DEVICE_INTERFACE_LIST_PRESENT,
 		)
 		if res != C.CR_SUCCESS {
-			return errors.New("CM_Get_Device_Interface_List_Size failed")
+			return nil, errors.New("CM_Get_Device_Interface_List_Size failed")
 		}
 
 		buf = make([]uint16, bufSize)
@@ -173,21 +181,26 @@ func (l *Listener) enumerate() error {
 		if res == C.CR_SUCCESS {
 			break
 		} else if res != C.CR_BUFFER_SMALL {
-			return errors.New("CM_Get_Device_Interface_List failed")
+			return nil, errors.New("CM_Get_Device_Interface_List failed")
 		}
 	}
 
+	var devIfs []*DeviceInterface
 	for _, symbolicLink := range splitUTF16StringList(buf) {
 		devIf := &DeviceInterface{}
 		devIf.classGuid = classGuid
 		devIf.symbolicLink = symbolicLink
-		l.handleArrive(devIf)
+		if l.prepareInterface(devIf) {
+			devIfs = append(devIfs, devIf)
+		}
 	}
 
-	return nil
+	return devIfs, nil
 }
 
-func (l *Listener) handleArrive(devIf *DeviceInterface) {
+// prepareInterface fills in the details of an interface from its symbolic link,
+// reporting whether it was successful.
+func (l *Listener) prepareInterface(devIf *DeviceInterface) bool {
 	devIf.Path = windows.UTF16ToString(devIf.symbolicLink)
 	devIf.Class = guidToInterfaceClass[devIf.classGuid]
 	devIf.Device = &Device{}
@@ -200,7 +213,7 @@ func (l *Listener) handleArrive(devIf *DeviceInterface) {
 		&devInstanceId,
 	)
 	if err != nil {
-		return
+		return false
 	}
 
 	status := C.CM_Locate_DevNodeW(
@@ -209,7 +222,7 @@ func (l *Listener) handleArrive(devIf *DeviceInterface) {
 		C.CM_LOCATE_DEVNODE_NORMAL,
 	)
 	if status != C.CR_SUCCESS {
-		return
+		return false
 	}
 
 	err = getDevPropFixed(
@@ -219,26 +232,10 @@ func (l *Listener) handleArrive(devIf *DeviceInterface) {
 		&devIf.Device.classGuid,
 	)
 	if err != nil {
-		return
+		return false
 	}
 
 	devIf.Device.Path = windows.UTF16ToString(devInstanceId[:])
 	devIf.Device.Class = guidToDeviceClass[devIf.Device.classGuid]
-	devIf.listener = l
-
-	devIf.inArrive = true
-	l.callback(devIf)
-	devIf.inArrive = false
-}
-
-func (l *Listener) handleRemove(devIfId string) {
-	callbacks := l.detachCb[devIfId]
-	if callbacks != nil {
-		for _, callback := range callbacks {
-			if callback != nil {
-				callback()
-			}
-		}
-	}
-	delete(l.detachCb, devIfId)
+	return true
 }
@@ -0,0 +1,404 @@
+package hotplug
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultModeWindow is how long a ModeTracker waits by default for a device
+// to come back after it leaves.
+const DefaultModeWindow = 10 * time.Second
+
+// A DeviceMode is one of the ways a device presents itself, such as its
+// application or its bootloader, told apart by USB IDs.
+type DeviceMode struct {
+	Name      string
+	VendorId  int
+	ProductId int
+}
+
+// A ModeTransition records a LogicalDevice arriving in a mode.
+type ModeTransition struct {
+	// From is the mode the device was last in, or empty if it has only
+	// just appeared.
+	From string
+
+	// To is the mode the device has arrived in, or empty if it left and
+	// didn't come back within the window.
+	To string
+
+	Time time.Time
+}
+
+// A LogicalDevice is a physical device followed as it leaves and comes back
+// in different modes, such as while its firmware is updated.
+type LogicalDevice struct {
+	// PortPath is the port the device is plugged into.
+	PortPath string
+
+	// lock protects the fields below
+	lock    sync.Mutex
+	mode    string
+	devIf   *DeviceInterface
+	history []ModeTransition
+
+	// changed, if not nil, is closed when the mode next changes
+	changed chan struct{}
+}
+
+// Mode returns the mode the device is in, or an empty string if it has
+// left.
+func (ld *LogicalDevice) Mode() string {
+	ld.lock.Lock()
+	defer ld.lock.Unlock()
+
+	return ld.mode
+}
+
+// Interface returns the interface through which the device is used in its
+// current mode, or nil if it has left and not yet come back.
+func (ld *LogicalDevice) Interface() *DeviceInterface {
+	ld.lock.Lock()
+	defer ld.lock.Unlock()
+
+	return ld.devIf
+}
+
+// WaitMode waits until the device is in the given mode, or has left if the
+// mode is empty, and returns the interface through which it is used in that
+// mode. It returns the context's error if the context is done first.
+func (ld *LogicalDevice) WaitMode(ctx context.Context, mode string) (*DeviceInterface, error) {
+	for {
+		ld.lock.Lock()
+		if ld.mode == mode {
+			devIf := ld.devIf
+			ld.lock.Unlock()
+			return devIf, nil
+		}
+		if ld.changed == nil {
+			ld.changed = make(chan struct{})
+		}
+		changed := ld.changed
+		ld.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// setMode changes the mode of the device and wakes anything waiting for it.
+// It must be called with the lock held.
+func (ld *LogicalDevice) setMode(mode string, devIf *DeviceInterface) {
+	ld.mode = mode
+	ld.devIf = devIf
+	if ld.changed != nil {
+		close(ld.changed)
+		ld.changed = nil
+	}
+}
+
+// History returns the transitions of the device so far, oldest first.
+func (ld *LogicalDevice) History() []ModeTransition {
+	ld.lock.Lock()
+	defer ld.lock.Unlock()
+
+	return append([]ModeTransition(nil), ld.history...)
+}
+
+// ModeTrackerConfig configures a ModeTracker.
+type ModeTrackerConfig struct {
+	// Modes lists the modes of the device. USB devices in none of them are
+	// ignored. A ProductId of zero matches any product of the vendor.
+	Modes []DeviceMode
+
+	// Window is how long after a device leaves a device arriving on the
+	// same port is taken to be the same device. Zero means
+	// DefaultModeWindow.
+	Window time.Duration
+
+	// OnTransition, if not nil, is called for each transition.
+	OnTransition func(ld *LogicalDevice, transition ModeTransition)
+
+	// OnMode maps the names of modes to functions to call when a device
+	// arrives in them, such as to start flashing once a bootloader appears.
+	// The callbacks queued behind a hook wait for it to return, so a hook
+	// which waits for the device to change mode again must do so with
+	// LogicalDevice.WaitMode rather than through OnTransition.
+	OnMode map[string]func(ld *LogicalDevice, devIf *DeviceInterface)
+}
+
+// A ModeTracker follows USB devices which leave and come back with
+// different IDs, as they do when switching between their application and
+// their bootloader, and reports them as LogicalDevices changing modes.
+//
+// A device which arrives on the port a device in one of the modes left,
+// within the window, is taken to be the same device, whatever its serial
+// number. A different device plugged into the same port in that time is
+// mistaken for it.
+//
+// The callbacks are called one at a time, in order, from a goroutine of
+// their own, so that they may wait for later transitions, such as a hook for
+// a bootloader mode flashing the device and waiting for it to come back in
+// its application mode.
+type ModeTracker struct {
+	config   ModeTrackerConfig
+	listener *Listener
+
+	// deliverLock serializes the changes of mode, and the queueing of the
+	// callbacks reporting them
+	deliverLock sync.Mutex
+
+	// queueLock protects the callbacks waiting to be run
+	queueLock sync.Mutex
+	queue     []func()
+	running   sync.WaitGroup
+
+	// lock protects the fields below
+	lock    sync.Mutex
+	stopped bool
+	present map[*DeviceInterface]*LogicalDevice
+
+	// departed holds the devices which have left, by port path, until
+	// their windows expire
+	departed map[string]*departedDevice
+}
+
+type departedDevice struct {
+	ld    *LogicalDevice
+	timer *time.Timer
+}
+
+// NewModeTracker creates a ModeTracker. The options are passed to New.
+func NewModeTracker(config ModeTrackerConfig, options ...Option) (*ModeTracker, error) {
+	if len(config.Modes) == 0 {
+		return nil, errors.New("no device modes given")
+	}
+	if config.Window < 0 {
+		return nil, errors.New("window must not be negative")
+	}
+	if config.Window == 0 {
+		config.Window = DefaultModeWindow
+	}
+
+	t := &ModeTracker{
+		config:   config,
+		present:  make(map[*DeviceInterface]*LogicalDevice),
+		departed: make(map[string]*departedDevice),
+	}
+
+	l, err := New(DevIfUsbDevice, t.arrive, options...)
+	if err != nil {
+		return nil, err
+	}
+	t.listener = l
+
+	return t, nil
+}
+
+// Start reports the devices which are present and then each transition as
+// it happens, as Listener.Start does.
+func (t *ModeTracker) Start() error {
+	t.lock.Lock()
+	t.stopped = false
+	t.lock.Unlock()
+
+	return t.listener.Start()
+}
+
+// Stop stops tracking devices. Devices which have left are forgotten
+// without reporting that they didn't come back. It waits for the callbacks
+// which are running or queued to finish, so it must not be called from a
+// callback.
+func (t *ModeTracker) Stop() error {
+	err := t.listener.Stop()
+	defer t.running.Wait()
+
+	t.deliverLock.Lock()
+	defer t.deliverLock.Unlock()
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.stopped = true
+	for port, departed := range t.departed {
+		departed.timer.Stop()
+		delete(t.departed, port)
+	}
+	t.present = make(map[*DeviceInterface]*LogicalDevice)
+
+	return err
+}
+
+// mode finds the mode a USB device is in, if any.
+func (t *ModeTracker) mode(dev *Device) *DeviceMode {
+	vendorId, err := dev.VendorId()
+	if err != nil {
+		return nil
+	}
+	productId, err := dev.ProductId()
+	if err != nil {
+		return nil
+	}
+
+	for i := range t.config.Modes {
+		mode := &t.config.Modes[i]
+		if mode.VendorId == vendorId && (mode.ProductId == 0 || mode.ProductId == productId) {
+			return mode
+		}
+	}
+
+	return nil
+}
+
+func (t *ModeTracker) arrive(devIf *DeviceInterface) {
+	mode := t.mode(devIf.Device)
+	if mode == nil {
+		return
+	}
+
+	port, err := devIf.Device.PortPath()
+	if err != nil {
+		return
+	}
+
+	t.deliverLock.Lock()
+	defer t.deliverLock.Unlock()
+
+	t.lock.Lock()
+	if t.stopped {
+		t.lock.Unlock()
+		return
+	}
+
+	var ld *LogicalDevice
+	if departed := t.departed[port]; departed != nil {
+		departed.timer.Stop()
+		delete(t.departed, port)
+		ld = departed.ld
+	} else {
+		ld = &LogicalDevice{PortPath: port}
+	}
+	t.present[devIf] = ld
+	t.lock.Unlock()
+
+	ld.lock.Lock()
+	transition := ModeTransition{From: ld.lastMode(), To: mode.Name, Time: time.Now()}
+	ld.setMode(mode.Name, devIf)
+	ld.history = append(ld.history, transition)
+	ld.lock.Unlock()
+
+	t.report(ld, transition)
+	if hook := t.config.OnMode[mode.Name]; hook != nil {
+		t.enqueue(func() { hook(ld, devIf) })
+	}
+
+	devIf.OnDetach(func() { t.remove(devIf) })
+}
+
+// lastMode returns the mode the device was last in, even if it has left. It
+// must be called with the lock held.
+func (ld *LogicalDevice) lastMode() string {
+	if len(ld.history) == 0 {
+		return ""
+	}
+	return ld.history[len(ld.history)-1].To
+}
+
+// remove starts the window in which a device which has left may come back.
+func (t *ModeTracker) remove(devIf *DeviceInterface) {
+	t.deliverLock.Lock()
+	defer t.deliverLock.Unlock()
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	ld := t.present[devIf]
+	if ld == nil {
+		return
+	}
+	delete(t.present, devIf)
+
+	ld.lock.Lock()
+	ld.setMode("", nil)
+	ld.lock.Unlock()
+
+	departed := &departedDevice{ld: ld}
+	departed.timer = time.AfterFunc(t.config.Window, func() {
+		t.expire(departed)
+	})
+	t.departed[ld.PortPath] = departed
+}
+
+// expire reports that a device which left didn't come back.
+func (t *ModeTracker) expire(departed *departedDevice) {
+	t.deliverLock.Lock()
+	defer t.deliverLock.Unlock()
+
+	ld := departed.ld
+
+	t.lock.Lock()
+	if t.departed[ld.PortPath] != departed {
+		t.lock.Unlock()
+		return
+	}
+	delete(t.departed, ld.PortPath)
+	t.lock.Unlock()
+
+	ld.lock.Lock()
+	transition := ModeTransition{From: ld.lastMode(), Time: time.Now()}
+	ld.history = append(ld.history, transition)
+	ld.lock.Unlock()
+
+	t.report(ld, transition)
+}
+
+// report queues the OnTransition callback for a transition. It must be
+// called with the deliverLock held.
+func (t *ModeTracker) report(ld *LogicalDevice, transition ModeTransition) {
+	if t.config.OnTransition != nil {
+		t.enqueue(func() { t.config.OnTransition(ld, transition) })
+	}
+}
+
+// enqueue queues a callback, starting a goroutine to run the queue if there
+// isn't one. It must be called with the deliverLock held so that callbacks
+// are queued in the order of the transitions.
+func (t *ModeTracker) enqueue(fn func()) {
+	t.queueLock.Lock()
+	defer t.queueLock.Unlock()
+
+	t.queue = append(t.queue, fn)
+	if len(t.queue) == 1 {
+		t.running.Add(1)
+		go t.drain()
+	}
+}
+
+// drain runs the queued callbacks until there are none left.
+func (t *ModeTracker) drain() {
+	defer t.running.Done()
+
+	// each callback stays in the queue while it runs so that enqueue
+	// doesn't start another goroutine
+	t.queueLock.Lock()
+	fn := t.queue[0]
+	t.queueLock.Unlock()
+
+	for {
+		t.listener.protect(fn)
+
+		t.queueLock.Lock()
+		t.queue = t.queue[1:]
+		if len(t.queue) == 0 {
+			t.queueLock.Unlock()
+			return
+		}
+		fn = t.queue[0]
+		t.queueLock.Unlock()
+	}
+}
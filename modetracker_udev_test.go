@@ -0,0 +1,184 @@
+//go:build linux
+
+package hotplug
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// usbEvent builds a udev monitor event for the receiver's USB device in
+// hidraw.db, on port 1-2, with the given address and product ID.
+func usbEvent(action string, seq int, address int, productId string) string {
+	devpath := "/devices/pci0000:00/0000:00:14.0/usb1/1-2"
+	return fmt.Sprintf(`UDEV  [1.%d] %-8s %s (usb)
+ACTION=%s
+DEVPATH=%s
+SUBSYSTEM=usb
+DEVTYPE=usb_device
+DEVNAME=/dev/bus/usb/001/%03d
+BUSNUM=001
+DEVNUM=%03d
+ID_VENDOR_ID=046d
+ID_MODEL_ID=%s
+SEQNUM=%d
+
+`, seq, action, devpath, action, devpath, address, address, productId, seq)
+}
+
+// firmwareUpdate is the receiver leaving, coming back as its bootloader,
+// and then coming back as itself.
+var firmwareUpdate = usbEvent("remove", 400, 5, "c52b") +
+	usbEvent("add", 401, 6, "df11") +
+	usbEvent("remove", 402, 6, "df11") +
+	usbEvent("add", 403, 7, "c52b")
+
+var receiverModes = []DeviceMode{
+	{Name: "app", VendorId: 0x046d, ProductId: 0xc52b},
+	{Name: "dfu", VendorId: 0x046d, ProductId: 0xdf11},
+}
+
+// startModeTracker starts a ModeTracker for receiverModes on the capture.
+func startModeTracker(t *testing.T, config ModeTrackerConfig, capture *Capture) *ModeTracker {
+	t.Helper()
+
+	config.Modes = receiverModes
+	tracker, err := NewModeTracker(config, FromCapture(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tracker.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tracker.Stop() })
+
+	return tracker
+}
+
+// expectTransitions checks the next transitions received, given as
+// "FROM>TO".
+func expectTransitions(t *testing.T, transitions <-chan string, want ...string) {
+	t.Helper()
+
+	for _, expected := range want {
+		select {
+		case got := <-transitions:
+			if got != expected {
+				t.Fatalf("got transition %q, want %q", got, expected)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", expected)
+		}
+	}
+}
+
+func TestModeTrackerFollowsDevice(t *testing.T) {
+	capture := loadCapture(t, "hidraw.db", "")
+	err := capture.ReadMonitor(strings.NewReader(firmwareUpdate))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transitions := make(chan string, 10)
+	devices := make(chan *LogicalDevice, 10)
+	startModeTracker(t, ModeTrackerConfig{
+		Window: time.Second,
+		OnTransition: func(ld *LogicalDevice, transition ModeTransition) {
+			devices <- ld
+			transitions <- transition.From + ">" + transition.To
+		},
+	}, capture)
+
+	expectTransitions(t, transitions, ">app", "app>dfu", "dfu>app")
+
+	ld := <-devices
+	for i := 0; i < 2; i++ {
+		if other := <-devices; other != ld {
+			t.Error("transitions were reported for different LogicalDevices")
+		}
+	}
+	if ld.PortPath != "1-2" {
+		t.Errorf("got port %q, want 1-2", ld.PortPath)
+	}
+
+	devIf, err := ld.WaitMode(context.Background(), "app")
+	if err != nil || devIf.Path != "/dev/bus/usb/001/007" {
+		t.Errorf("got %v, %v, want the device back in app mode", devIf, err)
+	}
+	if history := ld.History(); len(history) != 3 || history[1].To != "dfu" {
+		t.Errorf("got history %+v", history)
+	}
+}
+
+func TestModeTrackerWindowExpires(t *testing.T) {
+	capture := loadCapture(t, "hidraw.db", "")
+	err := capture.ReadMonitor(strings.NewReader(usbEvent("remove", 400, 5, "c52b")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transitions := make(chan string, 10)
+	start := time.Now()
+	startModeTracker(t, ModeTrackerConfig{
+		Window: 100 * time.Millisecond,
+		OnTransition: func(ld *LogicalDevice, transition ModeTransition) {
+			transitions <- transition.From + ">" + transition.To
+		},
+	}, capture)
+
+	expectTransitions(t, transitions, ">app", "app>")
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("the device was given up on after %v, before the window", elapsed)
+	}
+}
+
+func TestModeTrackerHookWaits(t *testing.T) {
+	capture := loadCapture(t, "hidraw.db", "")
+	err := capture.ReadMonitor(strings.NewReader(firmwareUpdate))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the hook for the bootloader blocks the callbacks queued behind it,
+	// but can still wait for the device to come back
+	results := make(chan string, 10)
+	startModeTracker(t, ModeTrackerConfig{
+		Window: time.Second,
+		OnTransition: func(ld *LogicalDevice, transition ModeTransition) {
+			results <- "transition " + transition.From + ">" + transition.To
+		},
+		OnMode: map[string]func(ld *LogicalDevice, devIf *DeviceInterface){
+			"dfu": func(ld *LogicalDevice, devIf *DeviceInterface) {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+
+				_, err := ld.WaitMode(ctx, "app")
+				results <- fmt.Sprintf("hook %s %v", devIf.Path, err)
+			},
+		},
+	}, capture)
+
+	expectTransitions(t, results,
+		"transition >app",
+		"transition app>dfu",
+		"hook /dev/bus/usb/001/006 <nil>",
+		"transition dfu>app",
+	)
+}
+
+func TestNewModeTrackerErrors(t *testing.T) {
+	_, err := NewModeTracker(ModeTrackerConfig{})
+	if err == nil {
+		t.Error("created a tracker without modes")
+	}
+
+	_, err = NewModeTracker(ModeTrackerConfig{Modes: receiverModes, Window: -time.Second})
+	if err == nil {
+		t.Error("created a tracker with a negative window")
+	}
+}
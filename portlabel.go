@@ -0,0 +1,165 @@
+package hotplug
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// A PortLocation describes where on the computer's case the port a USB
+// device is plugged into is, as reported by the firmware. Details which
+// aren't known are left empty.
+type PortLocation struct {
+	// ConnectType is "hotplug" for a port the user can plug devices into,
+	// "hardwired" for a port connected to a built-in device, "not used", or
+	// "unknown".
+	ConnectType string `json:"connect_type,omitempty"`
+
+	// Panel is the side of the case the port is on: "top", "bottom",
+	// "left", "right", "front", "back" or "unknown".
+	Panel string `json:"panel,omitempty"`
+
+	// VerticalPosition is "upper", "center" or "lower".
+	VerticalPosition string `json:"vertical_position,omitempty"`
+
+	// HorizontalPosition is "left", "center" or "right".
+	HorizontalPosition string `json:"horizontal_position,omitempty"`
+
+	// Dock and Lid report whether the port is on a docking station or on
+	// the lid of a laptop.
+	Dock bool `json:"dock,omitempty"`
+	Lid  bool `json:"lid,omitempty"`
+}
+
+// PortLabels maps port paths, as returned by Device.PortPath, to labels
+// which people can find, such as "front panel, left".
+type PortLabels map[string]string
+
+var portLabelsLock sync.RWMutex
+var portLabels PortLabels
+
+// SetPortLabels sets the labels returned by Device.PortLabel for the whole
+// program. Pass nil to remove them.
+func SetPortLabels(labels PortLabels) {
+	portLabelsLock.Lock()
+	defer portLabelsLock.Unlock()
+
+	portLabels = labels
+}
+
+// ReadPortLabels parses a file of port labels. Each line holds a port path
+// followed by whitespace and its label. Blank lines and lines starting with
+// # are ignored:
+//
+//	# port path  label
+//	1-1          front panel, left
+//	1-2          front panel, right
+func ReadPortLabels(r io.Reader) (PortLabels, error) {
+	labels := make(PortLabels)
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		port, label := text, ""
+		if i := strings.IndexAny(text, " \t"); i >= 0 {
+			port, label = text[:i], strings.TrimSpace(text[i:])
+		}
+		if label == "" {
+			return nil, fmt.Errorf("line %d: port %s has no label", line, port)
+		}
+		if _, ok := labels[port]; ok {
+			return nil, fmt.Errorf("line %d: port %s is labelled twice", line, port)
+		}
+
+		labels[port] = label
+	}
+
+	return labels, scanner.Err()
+}
+
+// LoadPortLabels reads a file of port labels in the format accepted by
+// ReadPortLabels.
+func LoadPortLabels(name string) (PortLabels, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadPortLabels(file)
+}
+
+// Label returns the label of a port. If the port itself isn't labelled but
+// is on a hub plugged into a port which is, that port's label is used
+// followed by the rest of the port path, such as "front panel, left / 3"
+// for port 3 of a hub plugged into the port labelled "front panel, left".
+// It returns an empty string if no label applies.
+func (labels PortLabels) Label(portPath string) string {
+	if label, ok := labels[portPath]; ok {
+		return label
+	}
+
+	// hub ports are separated by dots on Linux and by hashes in Windows
+	// location paths
+	upstream := portPath
+	for {
+		i := strings.LastIndexAny(upstream, ".#")
+		if i < 0 {
+			return ""
+		}
+		upstream = upstream[:i]
+
+		if label, ok := labels[upstream]; ok {
+			return label + " / " + portPath[len(upstream)+1:]
+		}
+	}
+}
+
+// PortLabel returns the label of the port the USB device which provides
+// this device is plugged into, from the labels set with SetPortLabels, or
+// an empty string if it has none.
+func (dev *Device) PortLabel() (string, error) {
+	usb, err := dev.usbDevice()
+	if err != nil {
+		return "", err
+	}
+
+	portPath, err := usb.PortPath()
+	if err != nil {
+		return "", err
+	}
+
+	portLabelsLock.RLock()
+	defer portLabelsLock.RUnlock()
+
+	return portLabels.Label(portPath), nil
+}
+
+// PortLocation describes where the port the USB device which provides this
+// device is plugged into is. It is only supported on Linux, where the
+// firmware must describe the port.
+func (dev *Device) PortLocation() (*PortLocation, error) {
+	usb, err := dev.usbDevice()
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := usb.portLocation()
+	if err != nil {
+		return nil, err
+	}
+
+	if *loc == (PortLocation{}) {
+		return nil, errors.New("the firmware doesn't describe the port")
+	}
+
+	return loc, nil
+}
@@ -0,0 +1,52 @@
+package hotplug
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadPortLabels(t *testing.T) {
+	labels, err := LoadPortLabels("testdata/labels.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(labels) != 2 || labels["1-2"] != "front panel, left" || labels["1-3"] != "back" {
+		t.Errorf("got %v", labels)
+	}
+}
+
+func TestReadPortLabelsErrors(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		err   string
+	}{
+		{"1-2\n", "line 1: port 1-2 has no label"},
+		{"# comment\n\n1-2 a\n1-2 b\n", "line 4: port 1-2 is labelled twice"},
+	} {
+		_, err := ReadPortLabels(strings.NewReader(test.input))
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%q: got error %v, want %q", test.input, err, test.err)
+		}
+	}
+}
+
+func TestPortLabelsLabel(t *testing.T) {
+	labels := PortLabels{"1-2": "hub", "1-2.3": "hub, right"}
+
+	for _, test := range []struct {
+		portPath string
+		want     string
+	}{
+		{"1-2", "hub"},
+		{"1-2.3", "hub, right"},
+		{"1-2.1", "hub / 1"},
+		{"1-2.1.4", "hub / 1.4"},
+		{"1-3", ""},
+		{"1-20", ""},
+	} {
+		if got := labels.Label(test.portPath); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.portPath, got, test.want)
+		}
+	}
+}
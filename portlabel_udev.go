@@ -0,0 +1,30 @@
+//go:build linux
+
+package hotplug
+
+import (
+	"errors"
+	"strings"
+)
+
+func (dev *Device) portLocation() (*PortLocation, error) {
+	if !dev.Is(DevUsbDevice) {
+		return nil, errors.New("port location is only available for USB devices")
+	}
+
+	// the port the device is plugged into is linked from the device, and
+	// the firmware's description of it, if any, is below the port
+	attr := func(name string) string {
+		val, _ := dev.sys.sysattr("port/" + name)
+		return strings.TrimSpace(val)
+	}
+
+	return &PortLocation{
+		ConnectType:        attr("connect_type"),
+		Panel:              attr("physical_location/panel"),
+		VerticalPosition:   attr("physical_location/vertical_position"),
+		HorizontalPosition: attr("physical_location/horizontal_position"),
+		Dock:               attr("physical_location/dock") == "yes",
+		Lid:                attr("physical_location/lid") == "yes",
+	}, nil
+}
@@ -0,0 +1,36 @@
+//go:build linux
+
+package hotplug
+
+import (
+	"testing"
+)
+
+func TestDevicePortLabel(t *testing.T) {
+	devIf, err := Find(DevIfHid, nil, FromCapture(loadCapture(t, "hidraw.db", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetPortLabels(PortLabels{"1-2": "front"})
+	defer SetPortLabels(nil)
+
+	// the label is found through the USB device above the interface
+	label, err := devIf.Device.PortLabel()
+	if err != nil || label != "front" {
+		t.Errorf("got %q, %v, want front", label, err)
+	}
+	if info := devIf.Info(); info.PortLabel != "front" {
+		t.Errorf("got %q in the interface info, want front", info.PortLabel)
+	}
+
+	// the PCI controller isn't provided by a USB device
+	controller, err := devIf.Device.Up(DevPci)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = controller.PortLabel()
+	if err == nil {
+		t.Error("got a port label for a PCI device")
+	}
+}
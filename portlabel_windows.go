@@ -0,0 +1,9 @@
+//go:build windows
+
+package hotplug
+
+import "errors"
+
+func (dev *Device) portLocation() (*PortLocation, error) {
+	return nil, errors.New("port locations are not supported on Windows")
+}
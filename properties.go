@@ -1,5 +1,11 @@
 package hotplug
 
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
 type InterfaceClass uint
 
 const (
@@ -8,6 +14,18 @@ const (
 	DevIfHid
 
 	DevIfPrinter
+
+	// DevIfSerial is a serial port, such as a USB CDC ACM modem or a USB
+	// serial adapter.
+	DevIfSerial
+
+	// DevIfDisk is a whole disk, such as a USB mass storage device.
+	DevIfDisk
+
+	// DevIfUsbDevice is the node through which a USB device is used
+	// directly, as libusb does. Every USB device has one, whatever its
+	// function.
+	DevIfUsbDevice
 )
 
 type DeviceClass uint
@@ -19,4 +37,76 @@ const (
 
 	DevUsbDevice
 	DevUsbInterface
+
+	// DevUsbHub is a USB hub, which is also a USB device.
+	DevUsbHub
+
+	// DevUsbHostController is a PCI USB host controller, which is also a PCI
+	// device.
+	DevUsbHostController
+
+	DevPci
+
+	// DevScsiHost is a SCSI host adapter, including the virtual ones which
+	// USB mass storage devices provide.
+	DevScsiHost
 )
+
+var interfaceClassNames = map[InterfaceClass]string{
+	DevIfHid:     "hid",
+	DevIfPrinter: "printer",
+	DevIfSerial:  "serial",
+	DevIfDisk:    "disk",
+
+	DevIfUsbDevice: "usb",
+}
+
+var deviceClassNames = map[DeviceClass]string{
+	DevHid:          "hid",
+	DevUsbDevice:    "usb_device",
+	DevUsbInterface: "usb_interface",
+
+	DevUsbHub:            "usb_hub",
+	DevUsbHostController: "usb_host_controller",
+	DevPci:               "pci",
+	DevScsiHost:          "scsi_host",
+}
+
+func (class InterfaceClass) String() string {
+	if name, ok := interfaceClassNames[class]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+func (class DeviceClass) String() string {
+	if name, ok := deviceClassNames[class]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// InterfaceClasses lists the supported interface classes.
+func InterfaceClasses() []InterfaceClass {
+	classes := make([]InterfaceClass, 0, len(interfaceClassNames))
+	for class := range interfaceClassNames {
+		classes = append(classes, class)
+	}
+
+	sort.Slice(classes, func(i, j int) bool {
+		return classes[i] < classes[j]
+	})
+	return classes
+}
+
+// ParseInterfaceClass finds the interface class with the given name, as
+// returned by InterfaceClass.String.
+func ParseInterfaceClass(name string) (InterfaceClass, error) {
+	for class, className := range interfaceClassNames {
+		if className == name {
+			return class, nil
+		}
+	}
+
+	return DevIfUnknown, errors.New(fmt.Sprintf("unknown interface class %q", name))
+}
@@ -2,48 +2,48 @@
 
 package hotplug
 
-/*
-	#cgo pkg-config: libudev
-	#include <libudev.h>
-	#include <string.h>
-*/
-import "C"
+import "strings"
 
 type deviceCondition struct {
-	subsystem *C.char
-	devtype   *C.char
-	driver    *C.char
+	subsystem string
+	devtype   string
+	driver    string
 
 	// interfaceOnly indicates that this sysfs device is only a DeviceInterface
 	// its Device is the parent sysfs device
 	interfaceOnly bool
+
+	// attr and attrPrefix, if set, require a sysfs attribute of the device to
+	// start with a value
+	attr       string
+	attrPrefix string
 }
 
-func (cond *deviceCondition) matches(dev *C.struct_udev_device) bool {
-	subsystem := C.udev_device_get_subsystem(dev)
-	if subsystem == nil || C.strcmp(cond.subsystem, subsystem) != 0 {
+func (cond *deviceCondition) matches(dev sysDevice) bool {
+	if dev.subsystem() != cond.subsystem {
 		return false
 	}
 
-	if cond.devtype != nil {
-		devtype := C.udev_device_get_devtype(dev)
-		if devtype == nil || C.strcmp(cond.devtype, devtype) != 0 {
-			return false
-		}
+	if cond.devtype != "" && dev.devtype() != cond.devtype {
+		return false
 	}
 
 	// beyond this point are properties of the device, not the interface,
 	// so we need to handle interface-only nodes
 	if cond.interfaceOnly {
-		dev = C.udev_device_get_parent(dev)
+		dev = dev.parent()
 		if dev == nil {
 			return false
 		}
 	}
 
-	if cond.driver != nil {
-		driver := C.udev_device_get_driver(dev)
-		if driver == nil || C.strcmp(cond.driver, driver) != 0 {
+	if cond.driver != "" && dev.driver() != cond.driver {
+		return false
+	}
+
+	if cond.attr != "" {
+		val, ok := dev.sysattr(cond.attr)
+		if !ok || !strings.HasPrefix(strings.TrimSpace(val), cond.attrPrefix) {
 			return false
 		}
 	}
@@ -53,26 +53,72 @@ func (cond *deviceCondition) matches(dev *C.struct_udev_device) bool {
 
 var interfaceClassCondition = map[InterfaceClass]*deviceCondition{
 	DevIfHid: {
-		subsystem:     C.CString("hidraw"),
+		subsystem:     "hidraw",
 		interfaceOnly: true,
 	},
 	DevIfPrinter: {
-		subsystem:     C.CString("usbmisc"),
-		driver:        C.CString("usblp"),
+		subsystem:     "usbmisc",
+		driver:        "usblp",
+		interfaceOnly: true,
+	},
+	// virtual terminals and pseudo-terminals have no parent, so only real
+	// ports match
+	DevIfSerial: {
+		subsystem:     "tty",
 		interfaceOnly: true,
 	},
+	// likewise loop and RAM disks
+	DevIfDisk: {
+		subsystem:     "block",
+		devtype:       "disk",
+		interfaceOnly: true,
+	},
+	DevIfUsbDevice: {
+		subsystem: "usb",
+		devtype:   "usb_device",
+	},
 }
 
 var deviceClassCondition = map[DeviceClass]*deviceCondition{
 	DevHid: {
-		subsystem: C.CString("hid"),
+		subsystem: "hid",
 	},
 	DevUsbDevice: {
-		subsystem: C.CString("usb"),
-		devtype:   C.CString("usb_device"),
+		subsystem: "usb",
+		devtype:   "usb_device",
 	},
 	DevUsbInterface: {
-		subsystem: C.CString("usb"),
-		devtype:   C.CString("usb_interface"),
+		subsystem: "usb",
+		devtype:   "usb_interface",
+	},
+	DevUsbHub: {
+		subsystem:  "usb",
+		devtype:    "usb_device",
+		attr:       "bDeviceClass",
+		attrPrefix: "09",
+	},
+	DevUsbHostController: {
+		subsystem:  "pci",
+		attr:       "class",
+		attrPrefix: "0x0c03",
 	},
+	DevPci: {
+		subsystem: "pci",
+	},
+	DevScsiHost: {
+		subsystem: "scsi",
+		devtype:   "scsi_host",
+	},
+}
+
+// deviceClassOrder lists the device classes in the order newDevice tries
+// them, so that a device which is in several classes gets the most specific.
+var deviceClassOrder = []DeviceClass{
+	DevHid,
+	DevUsbHub,
+	DevUsbDevice,
+	DevUsbInterface,
+	DevUsbHostController,
+	DevPci,
+	DevScsiHost,
 }
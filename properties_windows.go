@@ -17,6 +17,24 @@ var interfaceClassToGuid = map[InterfaceClass]C.GUID{
 		0x28D78FAD, 0x5A12, 0x11D1,
 		[8]C.uchar{0xAE, 0x5B, 0x00, 0x00, 0xF8, 0x03, 0xA8, 0xC2},
 	},
+
+	// GUID_DEVINTERFACE_COMPORT {86E0D1E0-8089-11D0-9CE4-08003E301F73}
+	DevIfSerial: C.GUID{
+		0x86E0D1E0, 0x8089, 0x11D0,
+		[8]C.uchar{0x9C, 0xE4, 0x08, 0x00, 0x3E, 0x30, 0x1F, 0x73},
+	},
+
+	// GUID_DEVINTERFACE_DISK {53F56307-B6BF-11D0-94F2-00A0C91EFB8B}
+	DevIfDisk: C.GUID{
+		0x53F56307, 0xB6BF, 0x11D0,
+		[8]C.uchar{0x94, 0xF2, 0x00, 0xA0, 0xC9, 0x1E, 0xFB, 0x8B},
+	},
+
+	// GUID_DEVINTERFACE_USB_DEVICE {A5DCBF10-6530-11D2-901F-00C04FB951ED}
+	DevIfUsbDevice: C.GUID{
+		0xA5DCBF10, 0x6530, 0x11D2,
+		[8]C.uchar{0x90, 0x1F, 0x00, 0xC0, 0x4F, 0xB9, 0x51, 0xED},
+	},
 }
 
 var deviceClassToGuid = map[DeviceClass]C.GUID{
@@ -31,6 +49,15 @@ var deviceClassToGuid = map[DeviceClass]C.GUID{
 		0x36FC9E60, 0xC465, 0x11CF,
 		[8]C.uchar{0x80, 0x56, 0x44, 0x45, 0x53, 0x54, 0x00, 0x00},
 	},
+
+	// SCSIAdapter {4d36e97b-e325-11ce-bfc1-08002be10318}
+	DevScsiHost: C.GUID{
+		0x4D36E97B, 0xE325, 0x11CE,
+		[8]C.uchar{0xBF, 0xC1, 0x08, 0x00, 0x2B, 0xE1, 0x03, 0x18},
+	},
+
+	// hubs and host controllers share the USB class with USB devices, and
+	// PCI devices have no class of their own, so they can't be told apart
 }
 
 var guidToInterfaceClass map[C.GUID]InterfaceClass
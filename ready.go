@@ -0,0 +1,137 @@
+package hotplug
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// defaultReadyTimeout is how long to wait for an interface to become ready
+// if the ReadyPolicy doesn't say.
+const defaultReadyTimeout = 10 * time.Second
+
+// readyPollInterval is how often the conditions of a ReadyPolicy are
+// checked.
+const readyPollInterval = 50 * time.Millisecond
+
+// A ReadyPolicy lists conditions an arriving interface must meet before it
+// is reported. Conditions which are false are not checked.
+//
+// The device node of an interface often appears before it can be used: udev
+// may still be applying its rules, which set permissions and create
+// symlinks, or a driver may not yet have been bound.
+type ReadyPolicy struct {
+	// Initialized waits until udev has finished processing the interface's
+	// device node. It only has an effect on Linux.
+	Initialized bool
+
+	// DriverBound waits until a driver is bound to the interface's Device.
+	// It only has an effect on Linux.
+	DriverBound bool
+
+	// AllInterfaces waits until every interface of the active configuration
+	// of the USB device providing the interface is present. It only has an
+	// effect on Linux, and none for interfaces not provided by USB devices.
+	AllInterfaces bool
+
+	// Openable waits until the interface's device node can be opened with
+	// OpenFlags, such as os.O_RDWR, which is usually only possible once
+	// udev has applied its rules.
+	Openable  bool
+	OpenFlags int
+
+	// Timeout is how long to wait before giving up. An interface which
+	// isn't ready in time is reported anyway, along with a *NotReadyError
+	// to the error handler. Zero means ten seconds.
+	Timeout time.Duration
+}
+
+// A NotReadyError is reported to the error handler when an interface didn't
+// meet the conditions of the ReadyPolicy in time.
+type NotReadyError struct {
+	Path string
+
+	// Reason describes the first condition which wasn't met.
+	Reason string
+}
+
+func (e *NotReadyError) Error() string {
+	return "device interface " + e.Path + " was not ready in time: " + e.Reason
+}
+
+// WaitReady makes the Listener wait until each arriving interface meets the
+// conditions of the policy before calling the callback. An interface which
+// is removed while waiting is not reported at all.
+//
+// While an interface is waiting it holds up the callbacks which the
+// dispatcher would run after it, so use DispatchPerDevice or DispatchPool to
+// keep one slow device from delaying the others.
+func WaitReady(policy ReadyPolicy) Option {
+	return func(l *Listener) error {
+		if policy.Timeout < 0 {
+			return errors.New("readiness timeout must not be negative")
+		}
+		if policy.Timeout == 0 {
+			policy.Timeout = defaultReadyTimeout
+		}
+
+		l.ready = &policy
+		return nil
+	}
+}
+
+// waitReady waits until an arriving interface meets the conditions of the
+// ReadyPolicy. It returns false if the interface was removed, or the
+// Listener stopped, in the meantime.
+func (l *Listener) waitReady(devIf *DeviceInterface, key string) bool {
+	l.lock.Lock()
+	halt := l.halt
+	l.lock.Unlock()
+
+	deadline := time.Now().Add(l.ready.Timeout)
+	for {
+		reason := l.notReady(devIf)
+		if reason == "" {
+			return true
+		}
+
+		l.lock.Lock()
+		present := l.present[key]
+		l.lock.Unlock()
+		if !present {
+			return false
+		}
+
+		if time.Now().After(deadline) {
+			l.report(&NotReadyError{Path: devIf.Path, Reason: reason})
+			return true
+		}
+
+		select {
+		case <-time.After(readyPollInterval):
+		case <-halt:
+			return false
+		case <-devIf.ctx.Done():
+			return false
+		}
+	}
+}
+
+// notReady returns the first condition of the ReadyPolicy which the
+// interface doesn't meet, or an empty string if it is ready.
+func (l *Listener) notReady(devIf *DeviceInterface) string {
+	reason := devIf.notReady(l.ready)
+	if reason != "" {
+		return reason
+	}
+
+	if l.ready.Openable {
+		file, err := os.OpenFile(devIf.Path, l.ready.OpenFlags, 0)
+		if err != nil {
+			return "device node can't be opened: " + err.Error()
+		}
+		file.Close()
+	}
+
+	return ""
+}
@@ -0,0 +1,73 @@
+//go:build linux
+
+package hotplug
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// notReady returns the first platform condition of the ReadyPolicy which the
+// interface doesn't meet, or an empty string if it meets them all. The
+// devices are looked up afresh since libudev caches their state.
+func (devIf *DeviceInterface) notReady(policy *ReadyPolicy) string {
+	source := devIf.Device.listener.source
+
+	if policy.Initialized {
+		node := source.lookup(devIf.sys.syspath())
+		if node == nil {
+			return "device node is gone"
+		}
+		if !node.initialized() {
+			return "udev has not finished processing the device"
+		}
+	}
+
+	if policy.DriverBound {
+		dev := source.lookup(devIf.Device.sys.syspath())
+		if dev == nil || dev.driver() == "" {
+			return "no driver is bound to the device"
+		}
+	}
+
+	if policy.AllInterfaces {
+		usb, err := devIf.Device.usbDevice()
+		if err != nil {
+			return ""
+		}
+
+		dev := source.lookup(usb.sys.syspath())
+		if dev == nil {
+			return "USB device is gone"
+		}
+
+		// the attribute is missing from captures, in which case there's no
+		// telling how many interfaces to expect
+		value, ok := dev.sysattr("bNumInterfaces")
+		if !ok {
+			return ""
+		}
+		want, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return "USB device is not configured"
+		}
+
+		children, err := source.children(dev.syspath())
+		if err != nil {
+			return "failed to list USB interfaces: " + err.Error()
+		}
+
+		have := 0
+		for _, child := range children {
+			if child.devtype() == "usb_interface" {
+				have++
+			}
+		}
+		if have < want {
+			return fmt.Sprintf("%d of %d USB interfaces are present", have, want)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package hotplug
+
+// notReady returns the first platform condition of the ReadyPolicy which the
+// interface doesn't meet. Windows only reports interfaces once their driver
+// has started, so there are none.
+func (devIf *DeviceInterface) notReady(policy *ReadyPolicy) string {
+	return ""
+}
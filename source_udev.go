@@ -0,0 +1,413 @@
+//go:build linux
+
+package hotplug
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+/*
+	#cgo pkg-config: libudev
+	#include <libudev.h>
+	#include <stdlib.h>
+*/
+import "C"
+
+// deviceSource supplies devices and device events to a Listener.
+type deviceSource interface {
+	// enumerate returns the devices currently present which are in the
+	// subsystem and devtype of the condition.
+	enumerate(cond *deviceCondition) ([]sysDevice, error)
+
+	// monitor delivers events for devices in the subsystem and devtype of
+	// any of the conditions to the sink until the returned stop function is
+	// called.
+	monitor(
+		conds []*deviceCondition,
+		sink monitorSink,
+		bufferSize int,
+	) (stop func() error, err error)
+
+	// lookup returns the current state of the device at a syspath, or nil
+	// if it isn't present.
+	lookup(syspath string) sysDevice
+
+	// children returns the devices whose parent is the device at a
+	// syspath.
+	children(syspath string) ([]sysDevice, error)
+}
+
+// monitorSink receives the output of a deviceSource's monitor.
+type monitorSink interface {
+	// handleEvent is called for each event.
+	handleEvent(dev sysDevice)
+
+	// fail is called if the monitor stops by itself because of an error.
+	fail(err error)
+
+	// overflow is called if events were lost.
+	overflow()
+}
+
+// udevSource is a deviceSource backed by the live system via libudev.
+type udevSource struct {
+	// lock serializes enumerations, which may be run from the eventPump
+	// thread to resynchronise as well as by the user
+	lock sync.Mutex
+	ctx  *udevContext
+}
+
+func newUdevSource() (*udevSource, error) {
+	ctx := newUdevContext()
+	if ctx == nil {
+		return nil, errors.New("failed to create udev context")
+	}
+
+	return &udevSource{ctx: ctx}, nil
+}
+
+func (src *udevSource) enumerate(cond *deviceCondition) ([]sysDevice, error) {
+	src.lock.Lock()
+	defer src.lock.Unlock()
+
+	enumerator := C.udev_enumerate_new(src.ctx.udev)
+	if nil == enumerator {
+		return nil, errors.New("failed to create udev enumerator")
+	}
+	defer C.udev_enumerate_unref(enumerator)
+
+	subsystem := C.CString(cond.subsystem)
+	defer C.free(unsafe.Pointer(subsystem))
+
+	res := C.udev_enumerate_add_match_subsystem(enumerator, subsystem)
+	if res < 0 {
+		return nil, errors.New("failed to add udev subsystem filter")
+	}
+
+	if cond.devtype != "" {
+		key := C.CString("DEVTYPE")
+		defer C.free(unsafe.Pointer(key))
+		devtype := C.CString(cond.devtype)
+		defer C.free(unsafe.Pointer(devtype))
+
+		res = C.udev_enumerate_add_match_property(enumerator, key, devtype)
+		if res < 0 {
+			return nil, errors.New("failed to add udev devtype filter")
+		}
+	}
+
+	res = C.udev_enumerate_scan_devices(enumerator)
+	if res < 0 {
+		return nil, errors.New("failed to perform udev enumeration")
+	}
+
+	var devices []sysDevice
+	entry := C.udev_enumerate_get_list_entry(enumerator)
+	for ; entry != nil; entry = C.udev_list_entry_get_next(entry) {
+		path := C.udev_list_entry_get_name(entry)
+		if path == nil {
+			continue
+		}
+
+		dev := C.udev_device_new_from_syspath(src.ctx.udev, path)
+		if dev == nil {
+			continue
+		}
+
+		devices = append(devices, newUdevDevice(src.ctx, dev))
+		C.udev_device_unref(dev)
+	}
+
+	return devices, nil
+}
+
+func (src *udevSource) lookup(syspath string) sysDevice {
+	src.lock.Lock()
+	defer src.lock.Unlock()
+
+	cPath := C.CString(syspath)
+	defer C.free(unsafe.Pointer(cPath))
+
+	dev := C.udev_device_new_from_syspath(src.ctx.udev, cPath)
+	if dev == nil {
+		return nil
+	}
+	defer C.udev_device_unref(dev)
+
+	return newUdevDevice(src.ctx, dev)
+}
+
+func (src *udevSource) children(syspath string) ([]sysDevice, error) {
+	src.lock.Lock()
+	defer src.lock.Unlock()
+
+	cPath := C.CString(syspath)
+	defer C.free(unsafe.Pointer(cPath))
+
+	parent := C.udev_device_new_from_syspath(src.ctx.udev, cPath)
+	if parent == nil {
+		return nil, errors.New("device is not present")
+	}
+	defer C.udev_device_unref(parent)
+
+	enumerator := C.udev_enumerate_new(src.ctx.udev)
+	if nil == enumerator {
+		return nil, errors.New("failed to create udev enumerator")
+	}
+	defer C.udev_enumerate_unref(enumerator)
+
+	res := C.udev_enumerate_add_match_parent(enumerator, parent)
+	if res < 0 {
+		return nil, errors.New("failed to add udev parent filter")
+	}
+
+	res = C.udev_enumerate_scan_devices(enumerator)
+	if res < 0 {
+		return nil, errors.New("failed to perform udev enumeration")
+	}
+
+	// the enumeration includes the parent and all of its descendants, some
+	// of which are in class directories rather than directly below their
+	// own parents
+	var devices []sysDevice
+	entry := C.udev_enumerate_get_list_entry(enumerator)
+	for ; entry != nil; entry = C.udev_list_entry_get_next(entry) {
+		name := C.udev_list_entry_get_name(entry)
+		if name == nil || C.GoString(name) == syspath {
+			continue
+		}
+
+		dev := C.udev_device_new_from_syspath(src.ctx.udev, name)
+		if dev == nil {
+			continue
+		}
+
+		parent := C.udev_device_get_parent(dev)
+		if parent != nil && C.GoString(C.udev_device_get_syspath(parent)) == syspath {
+			devices = append(devices, newUdevDevice(src.ctx, dev))
+		}
+		C.udev_device_unref(dev)
+	}
+
+	return devices, nil
+}
+
+// udevMonitor delivers events from a udev netlink monitor.
+type udevMonitor struct {
+	// the monitor has its own udev context because libudev is not
+	// thread-safe and the monitor is used from the eventPump thread
+	ctx       *udevContext
+	monitor   *C.struct_udev_monitor
+	sink      monitorSink
+	closeChan chan interface{}
+	closePipe []int
+	deviceFd  int
+}
+
+func (src *udevSource) monitor(
+	conds []*deviceCondition,
+	sink monitorSink,
+	bufferSize int,
+) (stop func() error, err error) {
+	var flags int
+	var res C.int
+	mon := &udevMonitor{sink: sink, deviceFd: -1}
+
+	name := C.CString("udev")
+	defer C.free(unsafe.Pointer(name))
+
+	mon.ctx = newUdevContext()
+	if mon.ctx == nil {
+		return nil, errors.New("failed to create udev context")
+	}
+
+	mon.monitor = C.udev_monitor_new_from_netlink(mon.ctx.udev, name)
+	if mon.monitor == nil {
+		return nil, errors.New("failed to create udev monitor")
+	}
+
+	for _, cond := range conds {
+		err = mon.addFilter(cond)
+		if err != nil {
+			goto fail
+		}
+	}
+
+	if bufferSize > 0 {
+		res = C.udev_monitor_set_receive_buffer_size(mon.monitor, (C.int)(bufferSize))
+		if res < 0 {
+			err = errors.New("failed to set udev monitor receive buffer size")
+			goto fail
+		}
+	}
+
+	res = C.udev_monitor_enable_receiving(mon.monitor)
+	if res < 0 {
+		err = errors.New("failed to enable udev monitor")
+		goto fail
+	}
+
+	mon.deviceFd = (int)(C.udev_monitor_get_fd(mon.monitor))
+	if mon.deviceFd < 0 {
+		err = errors.New("failed to get udev monitor fd")
+		goto fail
+	}
+
+	// ensure the file descriptor is close-on-exec
+	flags, err = unix.FcntlInt((uintptr)(mon.deviceFd), unix.F_GETFD, 0)
+	if err != nil {
+		goto fail
+	}
+	if flags&unix.FD_CLOEXEC == 0 {
+		_, err = unix.FcntlInt((uintptr)(mon.deviceFd), unix.F_SETFD, flags|unix.FD_CLOEXEC)
+		if err != nil {
+			goto fail
+		}
+	}
+
+	// ensure the file descriptor is non-blocking
+	// some older versions of udev are not by default
+	flags, err = unix.FcntlInt((uintptr)(mon.deviceFd), unix.F_GETFL, 0)
+	if err != nil {
+		goto fail
+	}
+	if flags&unix.O_NONBLOCK == 0 {
+		_, err = unix.FcntlInt((uintptr)(mon.deviceFd), unix.F_SETFL, flags|unix.O_NONBLOCK)
+		if err != nil {
+			goto fail
+		}
+	}
+
+	mon.closePipe = make([]int, 2)
+	err = unix.Pipe(mon.closePipe)
+	if err != nil {
+		goto fail
+	}
+
+	mon.closeChan = make(chan interface{})
+
+	go mon.eventPump()
+	return mon.stop, nil
+
+fail:
+	C.udev_monitor_unref(mon.monitor)
+	return nil, err
+}
+
+// addFilter makes the monitor receive events for devices in the subsystem
+// and devtype of a condition.
+func (mon *udevMonitor) addFilter(cond *deviceCondition) error {
+	subsystem := C.CString(cond.subsystem)
+	defer C.free(unsafe.Pointer(subsystem))
+	var devtype *C.char
+	if cond.devtype != "" {
+		devtype = C.CString(cond.devtype)
+		defer C.free(unsafe.Pointer(devtype))
+	}
+
+	res := C.udev_monitor_filter_add_match_subsystem_devtype(
+		mon.monitor,
+		subsystem,
+		devtype,
+	)
+	if res < 0 {
+		return errors.New("failed to add udev filter")
+	}
+
+	return nil
+}
+
+func (mon *udevMonitor) stop() error {
+	// signal the eventPump thread to exit
+	err := unix.Close(mon.closePipe[1])
+	if err != nil {
+		return err
+	}
+
+	// wait for the eventPump thread to exit
+	<-mon.closeChan
+
+	unix.Close(mon.closePipe[0])
+	C.udev_monitor_unref(mon.monitor)
+	mon.monitor = nil
+	mon.deviceFd = -1
+
+	return nil
+}
+
+func (mon *udevMonitor) eventPump() {
+	fds := []unix.PollFd{
+		{Fd: (int32)(mon.closePipe[0]), Events: unix.POLLHUP},
+		{Fd: (int32)(mon.deviceFd), Events: unix.POLLIN},
+	}
+
+	var failure error
+
+	for {
+		_, err := unix.Poll(fds, -1)
+		if err != nil {
+			if err.(syscall.Errno).Is(syscall.EINTR) {
+				continue
+			} else {
+				failure = fmt.Errorf("failed to poll udev monitor: %w", err)
+				break
+			}
+		}
+
+		if fds[0].Revents != 0 {
+			break
+		}
+
+		revents := fds[1].Revents
+		if revents&(unix.POLLHUP|unix.POLLNVAL) != 0 {
+			failure = errors.New(fmt.Sprintf(
+				"udev monitor socket failed (revents 0x%X)",
+				revents,
+			))
+			break
+		}
+
+		if revents&unix.POLLERR != 0 {
+			// the kernel drops messages when the socket's receive buffer
+			// is full and reports it as a pending ENOBUFS error, which
+			// reading SO_ERROR clears
+			errno, err := unix.GetsockoptInt(mon.deviceFd, unix.SOL_SOCKET, unix.SO_ERROR)
+			if err != nil {
+				failure = fmt.Errorf("failed to get udev monitor socket error: %w", err)
+				break
+			} else if syscall.Errno(errno) == unix.ENOBUFS {
+				mon.sink.overflow()
+			} else if errno != 0 {
+				failure = fmt.Errorf("udev monitor socket failed: %w", syscall.Errno(errno))
+				break
+			}
+		}
+
+		if revents&unix.POLLIN != 0 {
+			dev, err := C.udev_monitor_receive_device(mon.monitor)
+			if dev == nil {
+				// the error may also be reported by the read
+				if errors.Is(err, unix.ENOBUFS) {
+					mon.sink.overflow()
+				}
+				continue
+			}
+
+			mon.sink.handleEvent(newUdevDevice(mon.ctx, dev))
+			C.udev_device_unref(dev)
+		}
+	}
+
+	close(mon.closeChan)
+
+	// report the failure only once stop can no longer block, in case the
+	// error handler stops the Listener
+	if failure != nil {
+		mon.sink.fail(failure)
+	}
+}
@@ -0,0 +1,162 @@
+//go:build linux
+
+package hotplug
+
+import (
+	"encoding/binary"
+	"golang.org/x/sys/unix"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSink is a monitorSink which counts what it receives.
+type recordingSink struct {
+	lock      sync.Mutex
+	events    int
+	overflows int
+	failure   error
+}
+
+func (sink *recordingSink) handleEvent(dev sysDevice) {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	sink.events++
+}
+
+func (sink *recordingSink) fail(err error) {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	sink.failure = err
+}
+
+func (sink *recordingSink) overflow() {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	sink.overflows++
+}
+
+// murmurHash2 is the hash libudev's monitor filters use for subsystems.
+func murmurHash2(key string) uint32 {
+	const m = 0x5bd1e995
+	data := []byte(key)
+	h := uint32(len(data))
+
+	for len(data) >= 4 {
+		k := binary.LittleEndian.Uint32(data)
+		k *= m
+		k ^= k >> 24
+		k *= m
+		h *= m
+		h ^= k
+		data = data[4:]
+	}
+
+	switch len(data) {
+	case 3:
+		h ^= uint32(data[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[0])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return h
+}
+
+// udevMessage builds a message in the format udevd sends to monitors.
+func udevMessage(subsystem string) []byte {
+	props := "ACTION=add\x00DEVPATH=/devices/virtual/test\x00SUBSYSTEM=" + subsystem + "\x00SEQNUM=1\x00"
+
+	header := make([]byte, 40)
+	copy(header, "libudev\x00")
+	binary.BigEndian.PutUint32(header[8:], 0xfeedcafe)
+	binary.LittleEndian.PutUint32(header[12:], 40)
+	binary.LittleEndian.PutUint32(header[16:], 40)
+	binary.LittleEndian.PutUint32(header[20:], uint32(len(props)))
+	binary.BigEndian.PutUint32(header[24:], murmurHash2(subsystem))
+
+	return append(header, props...)
+}
+
+func TestUdevMonitorOverflow(t *testing.T) {
+	src, err := newUdevSource()
+	if err != nil {
+		t.Skip("udev isn't available: " + err.Error())
+	}
+
+	// the messages are sent as udevd does, to the udev multicast group,
+	// which needs privileges
+	sender, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		t.Skip("can't create a uevent socket: " + err.Error())
+	}
+	defer unix.Close(sender)
+
+	sink := &recordingSink{}
+	cond := &deviceCondition{subsystem: "hotplugtest"}
+	stop, err := src.monitor([]*deviceCondition{cond}, sink, 4096)
+	if err != nil {
+		t.Skip("can't monitor udev: " + err.Error())
+	}
+	defer stop()
+
+	// flood the monitor faster than it reads, until an overflow is
+	// reported
+	msg := udevMessage("hotplugtest")
+	dest := &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: 2}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		for i := 0; i < 1000; i++ {
+			err = unix.Sendto(sender, msg, 0, dest)
+			if err == unix.EPERM {
+				t.Skip("can't send to the udev multicast group: " + err.Error())
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		sink.lock.Lock()
+		overflows, failure := sink.overflows, sink.failure
+		sink.lock.Unlock()
+
+		if failure != nil {
+			t.Fatalf("monitor failed: %s", failure.Error())
+		} else if overflows > 0 {
+			break
+		} else if time.Now().After(deadline) {
+			t.Skip("couldn't overflow the monitor's receive buffer")
+		}
+	}
+
+	// the monitor keeps delivering events after the overflow
+	sink.lock.Lock()
+	before := sink.events
+	sink.lock.Unlock()
+
+	err = unix.Sendto(sender, msg, 0, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		sink.lock.Lock()
+		events, failure := sink.events, sink.failure
+		sink.lock.Unlock()
+
+		if failure != nil {
+			t.Fatalf("monitor failed: %s", failure.Error())
+		} else if events > before {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("monitor stopped delivering events after the overflow")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
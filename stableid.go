@@ -0,0 +1,75 @@
+package hotplug
+
+import (
+	"errors"
+	"fmt"
+)
+
+// IdentityStrategy selects what a stable device ID is derived from.
+type IdentityStrategy int
+
+const (
+	// IdentityAuto uses the serial number if the device has one and the
+	// port path otherwise, like udev's ID_SERIAL and ID_PATH.
+	IdentityAuto IdentityStrategy = iota
+
+	// IdentitySerial uses the vendor and product IDs and the serial number,
+	// which identify the device wherever it is plugged in. Not every
+	// device has a serial number, and cheap devices sometimes share one.
+	IdentitySerial
+
+	// IdentityPort uses the vendor and product IDs and the port path, which
+	// identify whichever device of the model is plugged into a port.
+	IdentityPort
+)
+
+// StableID returns an ID for the USB device which provides this device, or
+// the device itself, which stays the same when it is unplugged and plugged
+// back in, unlike Path and Address. It is equivalent to
+// StableIDUsing(IdentityAuto).
+func (dev *Device) StableID() (string, error) {
+	return dev.StableIDUsing(IdentityAuto)
+}
+
+// StableIDUsing returns a stable ID for the USB device which provides this
+// device, derived as the strategy says.
+//
+// IDs derived from the serial number take the form "046d:c52b:ABC123" and
+// those derived from the port path the form "046d:c52b@1-2", so the two
+// kinds never collide.
+func (dev *Device) StableIDUsing(strategy IdentityStrategy) (string, error) {
+	usb, err := dev.usbDevice()
+	if err != nil {
+		return "", err
+	}
+
+	vendorId, err := usb.VendorId()
+	if err != nil {
+		return "", err
+	}
+
+	productId, err := usb.ProductId()
+	if err != nil {
+		return "", err
+	}
+
+	if strategy == IdentityAuto || strategy == IdentitySerial {
+		serial, err := usb.SerialNumber()
+		if err == nil && serial != "" {
+			return fmt.Sprintf("%04x:%04x:%s", vendorId, productId, serial), nil
+		}
+
+		if strategy == IdentitySerial {
+			return "", errors.New("device has no serial number")
+		}
+	} else if strategy != IdentityPort {
+		return "", errors.New("unsupported IdentityStrategy")
+	}
+
+	portPath, err := usb.PortPath()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%04x:%04x@%s", vendorId, productId, portPath), nil
+}
@@ -0,0 +1,87 @@
+//go:build linux
+
+package hotplug
+
+import (
+	"testing"
+)
+
+func TestStableID(t *testing.T) {
+	withSerial, err := Find(DevIfHid, nil, FromCapture(loadCapture(t, "hidraw.db", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutSerial, err := Find(DevIfHid, nil, FromCapture(hidOnPorts(t, "1-9")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		devIf    *DeviceInterface
+		strategy IdentityStrategy
+		want     string
+		err      string
+	}{
+		{withSerial, IdentityAuto, "046d:c52b:ABC123", ""},
+		{withSerial, IdentitySerial, "046d:c52b:ABC123", ""},
+		{withSerial, IdentityPort, "046d:c52b@1-2", ""},
+		{withoutSerial, IdentityAuto, "046d:c52b@1-9", ""},
+		{withoutSerial, IdentitySerial, "", "device has no serial number"},
+		{withoutSerial, IdentityPort, "046d:c52b@1-9", ""},
+		{withSerial, IdentityStrategy(99), "", "unsupported IdentityStrategy"},
+	} {
+		got, err := test.devIf.Device.StableIDUsing(test.strategy)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s %d: got %q, %v, want error %q",
+					test.devIf.Path, test.strategy, got, err, test.err)
+			}
+		} else if err != nil || got != test.want {
+			t.Errorf("%s %d: got %q, %v, want %q",
+				test.devIf.Path, test.strategy, got, err, test.want)
+		}
+	}
+
+	id, err := withSerial.Device.StableID()
+	if err != nil || id != "046d:c52b:ABC123" {
+		t.Errorf("got %q, %v from StableID, want the serial form", id, err)
+	}
+}
+
+func TestStableIDNotUsb(t *testing.T) {
+	capture := loadCapture(t, "hidraw.db", "")
+	devIf, err := Find(DevIfHid, nil, FromCapture(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the PCI controller isn't provided by a USB device
+	controller, err := devIf.Device.Up(DevPci)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = controller.StableID()
+	if err == nil {
+		t.Error("got a stable ID for a PCI device")
+	}
+}
+
+func TestMatchStableID(t *testing.T) {
+	options := FromCapture(loadCapture(t, "hidraw.db", ""))
+
+	for _, test := range []struct {
+		id   string
+		want bool
+	}{
+		{"046d:c52b:ABC123", true},
+		{"046d:c52b@1-2", true},
+		{"046d:c52b@1-3", false},
+		{"1234:c52b:ABC123", false},
+	} {
+		_, err := Find(DevIfHid, MatchStableID(test.id), options)
+		if got := err == nil; got != test.want {
+			t.Errorf("%s: got match %t, want %t", test.id, got, test.want)
+		}
+	}
+}
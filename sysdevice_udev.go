@@ -0,0 +1,151 @@
+//go:build linux
+
+package hotplug
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+/*
+	#cgo pkg-config: libudev
+	#include <libudev.h>
+	#include <stdlib.h>
+*/
+import "C"
+
+// sysDevice is a node in the sysfs device tree as seen by udev.
+//
+// Devices normally come from libudev, but they can also be reconstructed
+// from a Capture so that listeners can be driven offline.
+type sysDevice interface {
+	devpath() string
+	syspath() string
+	subsystem() string
+	devtype() string
+	driver() string
+	devnode() string
+	action() string
+	seqnum() uint64
+
+	// initialized reports whether udev has finished processing the device,
+	// including applying its rules
+	initialized() bool
+
+	parent() sysDevice
+	property(key string) (string, bool)
+	sysattr(name string) (string, bool)
+}
+
+// udevContext owns a libudev context.
+//
+// libudev is not thread-safe, so each thread which uses libudev concurrently
+// with others needs its own context.
+type udevContext struct {
+	udev *C.struct_udev
+}
+
+func newUdevContext() *udevContext {
+	udev := C.udev_new()
+	if udev == nil {
+		return nil
+	}
+
+	ctx := &udevContext{udev: udev}
+	runtime.SetFinalizer(ctx, freeUdevContext)
+	return ctx
+}
+
+func freeUdevContext(ctx *udevContext) {
+	C.udev_unref(ctx.udev)
+	ctx.udev = nil
+}
+
+// udevDevice is a sysDevice backed by a libudev device handle.
+type udevDevice struct {
+	// prevents the udev context from being freed before the device
+	ctx  *udevContext
+	udev *C.struct_udev_device
+}
+
+// newUdevDevice wraps a libudev device, taking a new reference to it.
+func newUdevDevice(ctx *udevContext, udev *C.struct_udev_device) *udevDevice {
+	dev := &udevDevice{ctx: ctx, udev: udev}
+	C.udev_device_ref(udev)
+	runtime.SetFinalizer(dev, freeUdevDevice)
+	return dev
+}
+
+func freeUdevDevice(dev *udevDevice) {
+	C.udev_device_unref(dev.udev)
+	dev.udev = nil
+}
+
+func (dev *udevDevice) devpath() string {
+	return C.GoString(C.udev_device_get_devpath(dev.udev))
+}
+
+func (dev *udevDevice) syspath() string {
+	return C.GoString(C.udev_device_get_syspath(dev.udev))
+}
+
+func (dev *udevDevice) subsystem() string {
+	return C.GoString(C.udev_device_get_subsystem(dev.udev))
+}
+
+func (dev *udevDevice) devtype() string {
+	return C.GoString(C.udev_device_get_devtype(dev.udev))
+}
+
+func (dev *udevDevice) driver() string {
+	return C.GoString(C.udev_device_get_driver(dev.udev))
+}
+
+func (dev *udevDevice) devnode() string {
+	return C.GoString(C.udev_device_get_devnode(dev.udev))
+}
+
+func (dev *udevDevice) action() string {
+	return C.GoString(C.udev_device_get_action(dev.udev))
+}
+
+func (dev *udevDevice) seqnum() uint64 {
+	return (uint64)(C.udev_device_get_seqnum(dev.udev))
+}
+
+func (dev *udevDevice) initialized() bool {
+	return C.udev_device_get_is_initialized(dev.udev) > 0
+}
+
+func (dev *udevDevice) parent() sysDevice {
+	parent := C.udev_device_get_parent(dev.udev)
+	if parent == nil {
+		return nil
+	}
+
+	return newUdevDevice(dev.ctx, parent)
+}
+
+func (dev *udevDevice) property(key string) (string, bool) {
+	cKey := C.CString(key)
+	defer C.free(unsafe.Pointer(cKey))
+
+	val := C.udev_device_get_property_value(dev.udev, cKey)
+	if val == nil {
+		return "", false
+	}
+
+	return C.GoString(val), true
+}
+
+func (dev *udevDevice) sysattr(name string) (string, bool) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	val := C.udev_device_get_sysattr_value(dev.udev, cName)
+	if val == nil {
+		return "", false
+	}
+
+	return C.GoString(val), true
+}
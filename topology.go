@@ -0,0 +1,287 @@
+package hotplug
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// A Topology is a tree of devices, from the host controllers down through
+// hubs and USB devices to the devices providing interfaces, along with the
+// interfaces and their device nodes.
+//
+// A Topology can be serialised as JSON, or drawn with Graphviz using
+// WriteDOT.
+type Topology struct {
+	// Roots are the devices without parents, sorted by path.
+	Roots []*TopologyNode `json:"roots"`
+
+	nodes map[string]*TopologyNode
+}
+
+// A TopologyNode is a device in a Topology.
+type TopologyNode struct {
+	Device *Device `json:"-"`
+
+	Path  string `json:"path"`
+	Class string `json:"class"`
+
+	// the USB details are only set for USB devices, including hubs
+	VendorId     int    `json:"vendor_id,omitempty"`
+	ProductId    int    `json:"product_id,omitempty"`
+	SerialNumber string `json:"serial_number,omitempty"`
+	PortPath     string `json:"port_path,omitempty"`
+
+	// Interfaces are those provided by the device which were added to the
+	// Topology.
+	Interfaces []InterfaceInfo `json:"interfaces,omitempty"`
+
+	// Children are sorted by path.
+	Children []*TopologyNode `json:"children,omitempty"`
+
+	Parent *TopologyNode `json:"-"`
+}
+
+func NewTopology() *Topology {
+	return &Topology{nodes: make(map[string]*TopologyNode)}
+}
+
+// BuildTopology lists the interfaces of the given classes which match the
+// filter, which may be nil, and builds the Topology of the devices providing
+// them. Every USB device is included as well, along with, on Linux, all of
+// the devices below the root hubs, so that hubs and devices without
+// interfaces of the given classes appear. The options are passed to New.
+func BuildTopology(classes []InterfaceClass, filter Filter, options ...Option) (*Topology, error) {
+	t := NewTopology()
+
+	usbDevIfs, err := List(DevIfUsbDevice, nil, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, usbDevIf := range usbDevIfs {
+		usb := usbDevIf.Device
+		t.AddDevice(usb)
+
+		parent, err := usb.Parent()
+		if err == nil && !parent.Is(DevUsbDevice) {
+			// Descendants isn't supported on Windows, where the USB
+			// devices themselves have to do
+			t.AddSubtree(usb)
+		}
+	}
+
+	err = t.addInterfaces(classes, filter, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// BuildTopologyBelow builds the Topology of a device and all of the devices
+// below it, with the interfaces of the given classes which they provide and
+// which match the filter, which may be nil. The device is the only root. It
+// is only supported on Linux.
+func BuildTopologyBelow(root *Device, classes []InterfaceClass, filter Filter) (*Topology, error) {
+	t := NewTopology()
+	t.Roots = []*TopologyNode{t.newNode(root)}
+
+	_, err := t.AddSubtree(root)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, class := range classes {
+		devIfs, err := root.Interfaces(class)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, devIf := range devIfs {
+			if filter.Matches(devIf) {
+				t.AddInterface(devIf)
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// addInterfaces lists the interfaces of the given classes which match the
+// filter and adds them.
+func (t *Topology) addInterfaces(classes []InterfaceClass, filter Filter, options ...Option) error {
+	for _, class := range classes {
+		devIfs, err := List(class, filter, options...)
+		if err != nil {
+			return err
+		}
+
+		for _, devIf := range devIfs {
+			t.AddInterface(devIf)
+		}
+	}
+
+	return nil
+}
+
+// AddDevice adds a device to the Topology along with all of its ancestors,
+// if they aren't already present, and returns its node.
+func (t *Topology) AddDevice(dev *Device) *TopologyNode {
+	if node := t.nodes[dev.Path]; node != nil {
+		return node
+	}
+
+	node := t.newNode(dev)
+	parent, err := dev.Parent()
+	if err != nil {
+		t.Roots = insertNode(t.Roots, node)
+	} else {
+		node.Parent = t.AddDevice(parent)
+		node.Parent.Children = insertNode(node.Parent.Children, node)
+	}
+
+	return node
+}
+
+// AddSubtree adds a device to the Topology along with its ancestors and all
+// of the devices below it, if they aren't already present, and returns its
+// node. The devices below it can only be found on Linux.
+func (t *Topology) AddSubtree(dev *Device) (*TopologyNode, error) {
+	node := t.AddDevice(dev)
+
+	descendants, err := dev.Descendants()
+	if err != nil {
+		return node, err
+	}
+
+	// each device comes after its parent, so adding it stops there
+	for _, descendant := range descendants {
+		t.AddDevice(descendant)
+	}
+
+	return node, nil
+}
+
+// newNode creates the node of a device, without linking it into the tree.
+func (t *Topology) newNode(dev *Device) *TopologyNode {
+	node := &TopologyNode{Device: dev, Path: dev.Path, Class: dev.Class.String()}
+	if dev.Is(DevUsbDevice) {
+		node.VendorId, _ = dev.VendorId()
+		node.ProductId, _ = dev.ProductId()
+		node.SerialNumber, _ = dev.SerialNumber()
+		node.PortPath, _ = dev.PortPath()
+	}
+	t.nodes[dev.Path] = node
+	return node
+}
+
+// AddInterface adds an interface to the Topology under its device, which is
+// added along with its ancestors if they aren't already present, and returns
+// the device's node.
+func (t *Topology) AddInterface(devIf *DeviceInterface) *TopologyNode {
+	node := t.AddDevice(devIf.Device)
+
+	for _, info := range node.Interfaces {
+		if info.Path == devIf.Path {
+			return node
+		}
+	}
+
+	node.Interfaces = append(node.Interfaces, devIf.Info())
+	sort.SliceStable(node.Interfaces, func(i, j int) bool {
+		return comparePaths(node.Interfaces[i].Path, node.Interfaces[j].Path) < 0
+	})
+	return node
+}
+
+// Node returns the node of the device with the given path, or nil if it
+// isn't in the Topology.
+func (t *Topology) Node(path string) *TopologyNode {
+	return t.nodes[path]
+}
+
+// insertNode adds a node to a list sorted by path.
+func insertNode(nodes []*TopologyNode, node *TopologyNode) []*TopologyNode {
+	i := sort.Search(len(nodes), func(i int) bool {
+		return comparePaths(nodes[i].Path, node.Path) >= 0
+	})
+
+	nodes = append(nodes, nil)
+	copy(nodes[i+1:], nodes[i:])
+	nodes[i] = node
+	return nodes
+}
+
+// WriteDOT draws the Topology as a Graphviz graph. Devices are boxes labelled
+// with the last element of their path, their class and any USB details, and
+// device nodes are ellipses hanging off the devices providing them.
+func (t *Topology) WriteDOT(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "digraph devices {")
+	fmt.Fprintln(out, "\trankdir=LR;")
+	fmt.Fprintln(out, "\tnode [shape=box];")
+
+	next := 0
+	var visit func(node *TopologyNode, parentId string)
+	visit = func(node *TopologyNode, parentId string) {
+		id := fmt.Sprintf("d%d", next)
+		next++
+
+		lines := []string{lastPathElement(node.Path), node.Class}
+		if node.VendorId != 0 || node.ProductId != 0 {
+			lines = append(lines, fmt.Sprintf("%04x:%04x", node.VendorId, node.ProductId))
+		}
+		if node.SerialNumber != "" {
+			lines = append(lines, "serial "+node.SerialNumber)
+		}
+		if node.PortPath != "" {
+			lines = append(lines, "port "+node.PortPath)
+		}
+
+		fmt.Fprintf(out, "\t%s [label=%s];\n", id, dotLabel(lines))
+		if parentId != "" {
+			fmt.Fprintf(out, "\t%s -> %s;\n", parentId, id)
+		}
+
+		for i, info := range node.Interfaces {
+			ifId := fmt.Sprintf("%s_%d", id, i)
+			fmt.Fprintf(out, "\t%s [shape=ellipse, label=%s];\n", ifId,
+				dotLabel([]string{info.Path, info.Class}))
+			fmt.Fprintf(out, "\t%s -> %s;\n", id, ifId)
+		}
+
+		for _, child := range node.Children {
+			visit(child, id)
+		}
+	}
+
+	for _, root := range t.Roots {
+		visit(root, "")
+	}
+
+	fmt.Fprintln(out, "}")
+	return out.Flush()
+}
+
+// lastPathElement returns the part of a device path after the last slash or
+// backslash, so that labels stay short.
+func lastPathElement(path string) string {
+	trimmed := strings.TrimRight(path, `/\`)
+	if i := strings.LastIndexAny(trimmed, `/\`); i >= 0 && i < len(trimmed)-1 {
+		return trimmed[i+1:]
+	}
+	return path
+}
+
+// dotLabel quotes lines of text as a DOT string.
+func dotLabel(lines []string) string {
+	for i, line := range lines {
+		line = strings.ReplaceAll(line, `\`, `\\`)
+		line = strings.ReplaceAll(line, `"`, `\"`)
+		lines[i] = strings.ReplaceAll(line, "\n", " ")
+	}
+	return `"` + strings.Join(lines, `\n`) + `"`
+}
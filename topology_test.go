@@ -0,0 +1,30 @@
+package hotplug
+
+import (
+	"testing"
+)
+
+func TestLastPathElement(t *testing.T) {
+	for _, test := range []struct {
+		path string
+		want string
+	}{
+		{"/sys/devices/pci0000:00/0000:00:14.0/usb1/1-2", "1-2"},
+		{"/sys/devices/usb1/", "usb1"},
+		{`USB\VID_046D&PID_C52B\ABC123`, "ABC123"},
+		{"usb1", "usb1"},
+		{"/", "/"},
+	} {
+		if got := lastPathElement(test.path); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+func TestDotLabel(t *testing.T) {
+	got := dotLabel([]string{`a "b"`, `c\d`, "e\nf"})
+	want := `"a \"b\"\nc\\d\ne f"`
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
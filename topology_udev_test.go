@@ -0,0 +1,140 @@
+//go:build linux
+
+package hotplug
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// describeTopology lists the nodes of a Topology depth first, one per line,
+// indented by depth and giving the last element of the path, the class and
+// the paths of any interfaces.
+func describeTopology(topo *Topology) string {
+	var out strings.Builder
+	var visit func(node *TopologyNode, depth int)
+	visit = func(node *TopologyNode, depth int) {
+		out.WriteString(strings.Repeat("  ", depth) + lastPathElement(node.Path) + " " + node.Class)
+		for _, info := range node.Interfaces {
+			out.WriteString(" " + info.Path)
+		}
+		out.WriteString("\n")
+
+		for _, child := range node.Children {
+			if child.Parent != node {
+				out.WriteString("bad parent of " + child.Path + "\n")
+			}
+			visit(child, depth+1)
+		}
+	}
+
+	for _, root := range topo.Roots {
+		visit(root, 0)
+	}
+	return out.String()
+}
+
+func TestBuildTopology(t *testing.T) {
+	capture := loadCapture(t, "hidraw.db", "")
+	topo, err := BuildTopology([]InterfaceClass{DevIfHid}, nil, FromCapture(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `pci0000:00 unknown
+  0000:00:14.0 usb_host_controller
+    usb1 usb_hub
+      1-2 usb_device
+        1-2:1.0 usb_interface
+          0003:046D:C52B.0001 hid /dev/hidraw0
+            hidraw0 unknown
+`
+	if got := describeTopology(topo); got != want {
+		t.Errorf("got topology\n%s\nwant\n%s", got, want)
+	}
+
+	usb := topo.Node("/sys/devices/pci0000:00/0000:00:14.0/usb1/1-2")
+	if usb == nil || usb.VendorId != 0x046d || usb.ProductId != 0xc52b ||
+		usb.SerialNumber != "ABC123" || usb.PortPath != "1-2" {
+		t.Errorf("got USB node %+v, want the receiver's details", usb)
+	}
+
+	// the USB devices are included even if none of their interfaces are
+	topo, err = BuildTopology([]InterfaceClass{DevIfHid}, MatchSerial("nothing"), FromCapture(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := describeTopology(topo); got != strings.Replace(want, " /dev/hidraw0", "", 1) {
+		t.Errorf("got filtered topology\n%s", got)
+	}
+}
+
+func TestBuildTopologyBelow(t *testing.T) {
+	devIf, err := Find(DevIfHid, nil, FromCapture(loadCapture(t, "hidraw.db", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	usb, err := devIf.Device.Up(DevUsbDevice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	topo, err := BuildTopologyBelow(usb, []InterfaceClass{DevIfHid}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `1-2 usb_device
+  1-2:1.0 usb_interface
+    0003:046D:C52B.0001 hid /dev/hidraw0
+      hidraw0 unknown
+`
+	if got := describeTopology(topo); got != want {
+		t.Errorf("got topology\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestTopologyOutput(t *testing.T) {
+	topo, err := BuildTopology([]InterfaceClass{DevIfHid}, nil,
+		FromCapture(loadCapture(t, "hidraw.db", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dot bytes.Buffer
+	err = topo.WriteDOT(&dot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"digraph devices {\n",
+		"\td3 [label=\"1-2\\nusb_device\\n046d:c52b\\nserial ABC123\\nport 1-2\"];\n\t" +
+			"d2 -> d3;\n",
+		"\td5_0 [shape=ellipse, label=\"/dev/hidraw0\\nhid\"];\n\td5 -> d5_0;\n",
+	} {
+		if !strings.Contains(dot.String(), line) {
+			t.Errorf("DOT output lacks %q:\n%s", line, dot.String())
+		}
+	}
+
+	encoded, err := json.Marshal(topo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Roots []struct {
+			Path     string `json:"path"`
+			Children []json.RawMessage
+		} `json:"roots"`
+	}
+	err = json.Unmarshal(encoded, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Roots) != 1 || decoded.Roots[0].Path != "/sys/devices/pci0000:00" ||
+		len(decoded.Roots[0].Children) != 1 {
+		t.Errorf("got JSON %s", encoded)
+	}
+}
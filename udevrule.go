@@ -0,0 +1,336 @@
+package hotplug
+
+import (
+	"errors"
+	"path"
+	"strings"
+)
+
+// UdevMatch selects how a generated udev rule tells the device apart from
+// others.
+type UdevMatch int
+
+const (
+	// UdevMatchModel matches every device with the same vendor and product
+	// IDs.
+	UdevMatchModel UdevMatch = iota
+
+	// UdevMatchSerial also matches the serial number, so that the rule
+	// follows one particular device wherever it is plugged in.
+	UdevMatchSerial
+
+	// UdevMatchPort also matches the port path, so that the rule applies to
+	// whichever device of the model is plugged into a particular port.
+	UdevMatchPort
+)
+
+// UdevRuleOptions chooses what a generated udev rule matches and assigns.
+type UdevRuleOptions struct {
+	Match UdevMatch
+
+	// Mode is the permissions of the device node in octal, such as "0660",
+	// or empty to leave them alone.
+	Mode string
+
+	// Group is the group owning the device node, or empty to leave it alone.
+	Group string
+
+	// Uaccess grants access to the user logged in at the seat, through the
+	// "uaccess" tag understood by systemd-logind.
+	Uaccess bool
+
+	// Symlink is the name of a symbolic link to the device node to create
+	// under /dev, or empty for none. It mustn't contain whitespace, which udev
+	// takes as separating several names.
+	Symlink string
+}
+
+// A UdevRule is a udev rule which sets the permissions of the device node of
+// a USB device, or of one of its interfaces, and gives it a stable name.
+//
+// The match fields which are empty are left out of the rule. Vendor and
+// product IDs are written as in sysfs, as four hexadecimal digits. Devtype
+// tells apart devices of the same subsystem, such as a USB device and its
+// usb_interface children, which are all in the "usb" subsystem.
+type UdevRule struct {
+	Subsystem string
+	Devtype   string
+	VendorId  string
+	ProductId string
+	Serial    string
+	PortPath  string
+
+	Mode    string
+	Group   string
+	Uaccess bool
+	Symlink string
+
+	// target is the path of the device the rule was generated for
+	target string
+}
+
+// NewUdevRule generates a udev rule for a device, which must be a USB
+// device or a descendant of one. It is only supported on Linux.
+func NewUdevRule(dev *Device, options UdevRuleOptions) (*UdevRule, error) {
+	subsystem, err := dev.Property("SUBSYSTEM")
+	if err != nil {
+		return nil, errors.New("failed to get udev subsystem: " + err.Error())
+	}
+
+	// not every device has a type, so a missing one is left out of the rule
+	devtype, _ := dev.Property("DEVTYPE")
+
+	usb := dev
+	if _, err := dev.Attribute("idVendor"); err != nil {
+		usb, err = dev.Up(DevUsbDevice)
+		if err != nil {
+			return nil, errors.New("device is not provided by a USB device")
+		}
+	}
+
+	rule := &UdevRule{
+		Subsystem: subsystem,
+		Devtype:   devtype,
+		Mode:      options.Mode,
+		Group:     options.Group,
+		Uaccess:   options.Uaccess,
+		Symlink:   options.Symlink,
+		target:    dev.Path,
+	}
+
+	rule.VendorId, err = usb.Attribute("idVendor")
+	if err != nil {
+		return nil, errors.New("failed to get vendor ID: " + err.Error())
+	}
+
+	rule.ProductId, err = usb.Attribute("idProduct")
+	if err != nil {
+		return nil, errors.New("failed to get product ID: " + err.Error())
+	}
+
+	switch options.Match {
+	case UdevMatchModel:
+	case UdevMatchSerial:
+		rule.Serial, err = usb.SerialNumber()
+		if err != nil || rule.Serial == "" {
+			return nil, errors.New("device has no serial number; match its port instead")
+		}
+	case UdevMatchPort:
+		rule.PortPath, err = usb.PortPath()
+		if err != nil {
+			return nil, errors.New("failed to get port path: " + err.Error())
+		}
+	default:
+		return nil, errors.New("unsupported UdevMatch")
+	}
+
+	err = rule.check()
+	if err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+// NewInterfaceUdevRule generates a udev rule for the device node of an
+// interface. It is only supported on Linux.
+func NewInterfaceUdevRule(devIf *DeviceInterface, options UdevRuleOptions) (*UdevRule, error) {
+	return NewUdevRule(devIf.node(), options)
+}
+
+// check makes sure the rule can be written correctly.
+func (rule *UdevRule) check() error {
+	if rule.Mode == "" && rule.Group == "" && !rule.Uaccess && rule.Symlink == "" {
+		return errors.New("rule assigns nothing; set a mode, group, uaccess or symlink")
+	}
+
+	if rule.Mode != "" {
+		if len(rule.Mode) < 3 || len(rule.Mode) > 4 || strings.Trim(rule.Mode, "01234567") != "" {
+			return errors.New("mode must be three or four octal digits, such as 0660")
+		}
+	}
+
+	for _, field := range []struct {
+		name  string
+		value string
+		chars string
+	}{
+		// values which are matched mustn't contain glob patterns
+		{"subsystem", rule.Subsystem, "\"\n*?[|"},
+		{"device type", rule.Devtype, "\"\n*?[|"},
+		{"vendor ID", rule.VendorId, "\"\n*?[|"},
+		{"product ID", rule.ProductId, "\"\n*?[|"},
+		{"serial number", rule.Serial, "\"\n*?[|"},
+		{"port path", rule.PortPath, "\"\n*?[|"},
+		{"group", rule.Group, "\"\n "},
+		// udev splits the symlink names at whitespace
+		{"symlink", rule.Symlink, "\"\n\t "},
+	} {
+		if strings.ContainsAny(field.value, field.chars) {
+			return errors.New(field.name + " contains characters which can't be used in a udev rule")
+		}
+	}
+
+	return nil
+}
+
+// String formats the rule as a line of a udev rules file.
+func (rule *UdevRule) String() string {
+	var keys []string
+
+	if rule.Subsystem != "" {
+		keys = append(keys, `SUBSYSTEM=="`+rule.Subsystem+`"`)
+	}
+	if rule.Devtype != "" {
+		keys = append(keys, `ENV{DEVTYPE}=="`+rule.Devtype+`"`)
+	}
+	if rule.VendorId != "" {
+		keys = append(keys, `ATTRS{idVendor}=="`+rule.VendorId+`"`)
+	}
+	if rule.ProductId != "" {
+		keys = append(keys, `ATTRS{idProduct}=="`+rule.ProductId+`"`)
+	}
+	if rule.Serial != "" {
+		keys = append(keys, `ATTRS{serial}=="`+rule.Serial+`"`)
+	}
+	if rule.PortPath != "" {
+		keys = append(keys, `KERNELS=="`+rule.PortPath+`"`)
+	}
+
+	if rule.Mode != "" {
+		keys = append(keys, `MODE="`+rule.Mode+`"`)
+	}
+	if rule.Group != "" {
+		keys = append(keys, `GROUP="`+rule.Group+`"`)
+	}
+	if rule.Uaccess {
+		keys = append(keys, `TAG+="uaccess"`)
+	}
+	if rule.Symlink != "" {
+		keys = append(keys, `SYMLINK+="`+rule.Symlink+`"`)
+	}
+
+	return strings.Join(keys, ", ")
+}
+
+// Matches reports whether udev would apply the rule to a device.
+//
+// As in udev, the ATTRS and KERNELS keys must all match the same device,
+// which may be the device itself or any of its ancestors.
+func (rule *UdevRule) Matches(dev *Device) bool {
+	if rule.Subsystem != "" {
+		subsystem, err := dev.Property("SUBSYSTEM")
+		if err != nil || subsystem != rule.Subsystem {
+			return false
+		}
+	}
+	if rule.Devtype != "" {
+		devtype, err := dev.Property("DEVTYPE")
+		if err != nil || devtype != rule.Devtype {
+			return false
+		}
+	}
+
+	attrs := map[string]string{
+		"idVendor":  rule.VendorId,
+		"idProduct": rule.ProductId,
+		"serial":    rule.Serial,
+	}
+
+	for ancestor := dev; ancestor != nil; {
+		if rule.matchesAncestor(ancestor, attrs) {
+			return true
+		}
+
+		parent, err := ancestor.Parent()
+		if err != nil {
+			break
+		}
+		ancestor = parent
+	}
+
+	return false
+}
+
+func (rule *UdevRule) matchesAncestor(dev *Device, attrs map[string]string) bool {
+	if rule.PortPath != "" && path.Base(dev.Path) != rule.PortPath {
+		return false
+	}
+
+	for name, want := range attrs {
+		if want == "" {
+			continue
+		}
+
+		value, err := dev.Attribute(name)
+		if err != nil || strings.TrimSpace(value) != want {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Validate checks the rule against the devices which are present, which are
+// found by listing the interfaces of every class along with their devices
+// and ancestors. It returns the devices the rule applies to, so that a rule
+// which applies more widely than intended can be spotted. If the rule was
+// generated for a device which is present but the rule doesn't apply to
+// it, Validate returns an error. The options are passed to New.
+func (rule *UdevRule) Validate(options ...Option) ([]*Device, error) {
+	err := rule.check()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	targetSeen := false
+	var matches []*Device
+
+	visit := func(dev *Device) bool {
+		if seen[dev.Path] {
+			return false
+		}
+		seen[dev.Path] = true
+
+		if dev.Path == rule.target {
+			targetSeen = true
+		}
+		if rule.Matches(dev) {
+			matches = append(matches, dev)
+		}
+		return true
+	}
+
+	for _, class := range InterfaceClasses() {
+		devIfs, err := List(class, nil, options...)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, devIf := range devIfs {
+			visit(devIf.node())
+			for dev := devIf.Device; dev != nil && visit(dev); {
+				parent, err := dev.Parent()
+				if err != nil {
+					break
+				}
+				dev = parent
+			}
+		}
+	}
+
+	sortDevices(matches)
+
+	if targetSeen {
+		found := false
+		for _, dev := range matches {
+			found = found || dev.Path == rule.target
+		}
+		if !found {
+			return matches, errors.New("rule doesn't apply to the device it was generated for")
+		}
+	}
+
+	return matches, nil
+}
@@ -0,0 +1,93 @@
+//go:build linux
+
+package hotplug
+
+import (
+	"testing"
+)
+
+func TestNewUdevRule(t *testing.T) {
+	options := FromCapture(loadCapture(t, "hidraw.db", ""))
+	devIf, err := Find(DevIfHid, nil, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usb, err := devIf.Device.Up(DevUsbDevice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name    string
+		dev     *Device
+		options UdevRuleOptions
+		want    string
+	}{
+		{
+			"device by serial",
+			usb,
+			UdevRuleOptions{Match: UdevMatchSerial, Mode: "0660"},
+			`SUBSYSTEM=="usb", ENV{DEVTYPE}=="usb_device", ATTRS{idVendor}=="046d", ATTRS{idProduct}=="c52b", ATTRS{serial}=="ABC123", MODE="0660"`,
+		},
+		{
+			"interface by port",
+			devIf.node(),
+			UdevRuleOptions{Match: UdevMatchPort, Uaccess: true, Symlink: "receiver"},
+			`SUBSYSTEM=="hidraw", ATTRS{idVendor}=="046d", ATTRS{idProduct}=="c52b", KERNELS=="1-2", TAG+="uaccess", SYMLINK+="receiver"`,
+		},
+		{
+			"interface by model",
+			devIf.node(),
+			UdevRuleOptions{Match: UdevMatchModel, Group: "plugdev"},
+			`SUBSYSTEM=="hidraw", ATTRS{idVendor}=="046d", ATTRS{idProduct}=="c52b", GROUP="plugdev"`,
+		},
+	} {
+		rule, err := NewUdevRule(test.dev, test.options)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err.Error())
+			continue
+		}
+
+		if got := rule.String(); got != test.want {
+			t.Errorf("%s: got\n\t%s\nwant\n\t%s", test.name, got, test.want)
+		}
+
+		// the rule mustn't apply to the device's interfaces or other
+		// devices along the way
+		applies, err := rule.Validate(options)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err.Error())
+		} else if len(applies) != 1 || applies[0].Path != test.dev.Path {
+			var paths []string
+			for _, dev := range applies {
+				paths = append(paths, dev.Path)
+			}
+			t.Errorf("%s: rule applies to %v, want only %s", test.name, paths, test.dev.Path)
+		}
+	}
+}
+
+func TestNewUdevRuleErrors(t *testing.T) {
+	devIf, err := Find(DevIfHid, nil, FromCapture(loadCapture(t, "hidraw.db", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		options UdevRuleOptions
+		err     string
+	}{
+		{UdevRuleOptions{}, "rule assigns nothing; set a mode, group, uaccess or symlink"},
+		{UdevRuleOptions{Mode: "rw"}, "mode must be three or four octal digits, such as 0660"},
+		{UdevRuleOptions{Mode: "06600"}, "mode must be three or four octal digits, such as 0660"},
+		{UdevRuleOptions{Symlink: "my receiver"}, "symlink contains characters which can't be used in a udev rule"},
+		{UdevRuleOptions{Symlink: "a\"b"}, "symlink contains characters which can't be used in a udev rule"},
+		{UdevRuleOptions{Group: "a b"}, "group contains characters which can't be used in a udev rule"},
+		{UdevRuleOptions{Match: UdevMatch(99), Mode: "0660"}, "unsupported UdevMatch"},
+	} {
+		_, err := NewInterfaceUdevRule(devIf, test.options)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%+v: got error %v, want %q", test.options, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package hotplug
+
+import (
+	"context"
+	"sync"
+)
+
+// WaitFor waits until an interface of the given class which matches the
+// filter is present and returns it. If one is already present it returns
+// immediately. It gives up when the context is done, returning its error.
+// The options are passed to New, except that callbacks are always dispatched
+// serially.
+//
+// The Listener used to find the interface keeps running until the
+// interface is removed, so that its Done channel and Context work.
+func WaitFor(
+	ctx context.Context,
+	class InterfaceClass,
+	filter Filter,
+	options ...Option,
+) (*DeviceInterface, error) {
+	found := make(chan *DeviceInterface, 1)
+	var once sync.Once
+
+	// the interfaces already present must have been seen when Start
+	// returns
+	options = append(options, DispatchSerial())
+
+	l, err := New(class, func(devIf *DeviceInterface) {
+		if filter.Matches(devIf) {
+			once.Do(func() { found <- devIf })
+		}
+	}, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.Start()
+	if err != nil {
+		l.Stop()
+		return nil, err
+	}
+
+	// an interface which is already present is returned even if the
+	// context is already done
+	select {
+	case devIf := <-found:
+		return waitForStop(l, devIf), nil
+	default:
+	}
+
+	select {
+	case devIf := <-found:
+		return waitForStop(l, devIf), nil
+
+	case <-ctx.Done():
+		l.Stop()
+		return nil, ctx.Err()
+	}
+}
+
+// waitForStop stops the Listener used by WaitFor once the interface it found
+// is removed.
+func waitForStop(l *Listener, devIf *DeviceInterface) *DeviceInterface {
+	go func() {
+		<-devIf.Done()
+		l.Stop()
+	}()
+	return devIf
+}
+
+// WaitForRemoval waits until no interface of the given class which matches
+// the filter is present. If none is present it returns immediately. It gives
+// up when the context is done, returning its error. The options are passed
+// to New, except that callbacks are always dispatched serially.
+func WaitForRemoval(
+	ctx context.Context,
+	class InterfaceClass,
+	filter Filter,
+	options ...Option,
+) error {
+	var lock sync.Mutex
+	present := make(map[*DeviceInterface]bool)
+	started := false
+	gone := make(chan struct{})
+
+	// the interfaces already present must have been seen when Start
+	// returns, or none would seem to be present
+	options = append(options, DispatchSerial())
+
+	// must be called with the lock held
+	check := func() {
+		if started && len(present) == 0 {
+			select {
+			case <-gone:
+			default:
+				close(gone)
+			}
+		}
+	}
+
+	l, err := New(class, func(devIf *DeviceInterface) {
+		if !filter.Matches(devIf) {
+			return
+		}
+
+		lock.Lock()
+		present[devIf] = true
+		lock.Unlock()
+
+		devIf.OnDetach(func() {
+			lock.Lock()
+			delete(present, devIf)
+			check()
+			lock.Unlock()
+		})
+	}, options...)
+	if err != nil {
+		return err
+	}
+
+	err = l.Start()
+	defer l.Stop()
+	if err != nil {
+		return err
+	}
+
+	lock.Lock()
+	started = true
+	check()
+	lock.Unlock()
+
+	select {
+	case <-gone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,89 @@
+//go:build linux
+
+package hotplug
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWaitForPresent(t *testing.T) {
+	// an interface which is already present is found even if the context
+	// is done, whatever the dispatch mode
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	devIf, err := WaitFor(ctx, DevIfHid, nil,
+		FromCapture(loadCapture(t, "hidraw.db", "")), DispatchPool(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if devIf.Path != "/dev/hidraw0" {
+		t.Errorf("got %s, want /dev/hidraw0", devIf.Path)
+	}
+}
+
+func TestWaitForArrival(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	devIf, err := WaitFor(ctx, DevIfHid, MatchVendorProduct(0x1234, 0x5678),
+		FromCapture(loadCapture(t, "hidraw.db", "hidraw.events")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if devIf.Path != "/dev/hidraw1" {
+		t.Errorf("got %s, want /dev/hidraw1", devIf.Path)
+	}
+
+	// the Listener keeps running until the interface is removed
+	select {
+	case <-devIf.Done():
+	case <-time.After(5 * time.Second):
+		t.Error("removal of hidraw1 wasn't seen")
+	}
+}
+
+func TestWaitForTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := WaitFor(ctx, DevIfHid, MatchSerial("nothing"),
+		FromCapture(loadCapture(t, "hidraw.db", "hidraw.events")))
+	if err != context.DeadlineExceeded {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestWaitForRemoval(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := WaitForRemoval(ctx, DevIfHid, MatchVendorProduct(0x046d, 0xc52b),
+		FromCapture(loadCapture(t, "hidraw.db", "hidraw.events")))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitForRemovalOfPresentInterface(t *testing.T) {
+	// hidraw0 stays, so this must time out, even when the callbacks would
+	// otherwise run after Start returns
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := WaitForRemoval(ctx, DevIfHid, nil,
+		FromCapture(loadCapture(t, "hidraw.db", "")), DispatchPerDevice())
+	if err != context.DeadlineExceeded {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestWaitForRemovalOfAbsentInterface(t *testing.T) {
+	err := WaitForRemoval(context.Background(), DevIfHid, MatchSerial("nothing"),
+		FromCapture(loadCapture(t, "hidraw.db", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+}